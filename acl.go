@@ -0,0 +1,124 @@
+package overwrite
+
+import (
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Predefined group grantee URIs
+const (
+	AllUsersURI           = "http://acs.amazonaws.com/groups/global/AllUsers"
+	AuthenticatedUsersURI = "http://acs.amazonaws.com/groups/global/AuthenticatedUsers"
+	LogDeliveryURI        = "http://acs.amazonaws.com/groups/s3/LogDelivery"
+)
+
+// ObjectACL is the access control list preserved on overwrite.
+// Changes the callback makes to Grants are applied to the new object.
+type ObjectACL struct {
+	Owner  ACLOwner // informational; the writer owns the new object
+	Grants []Grant
+}
+
+// ACLOwner identifies the owner of an object
+type ACLOwner struct {
+	ID          string
+	DisplayName string
+}
+
+// Grant gives a grantee a permission on the object.
+// Exactly one of ID, URI and EmailAddress identifies the grantee.
+type Grant struct {
+	GranteeType  types.Type       `json:"grantee_type,omitempty"` // CanonicalUser, Group or AmazonCustomerByEmail
+	ID           string           `json:"id,omitempty"`
+	URI          string           `json:"uri,omitempty"`
+	EmailAddress string           `json:"email_address,omitempty"`
+	DisplayName  string           `json:"display_name,omitempty"`
+	Permission   types.Permission `json:"permission"`
+}
+
+// newObjectACL converts an ACL returned by GetObjectAcl
+func newObjectACL(owner *types.Owner, grants []types.Grant) *ObjectACL {
+	acl := &ObjectACL{}
+	if owner != nil {
+		acl.Owner = ACLOwner{ID: aws.ToString(owner.ID), DisplayName: aws.ToString(owner.DisplayName)}
+	}
+	for _, g := range grants {
+		if g.Grantee == nil {
+			continue
+		}
+		acl.Grants = append(acl.Grants, Grant{
+			GranteeType:  g.Grantee.Type,
+			ID:           aws.ToString(g.Grantee.ID),
+			URI:          aws.ToString(g.Grantee.URI),
+			EmailAddress: aws.ToString(g.Grantee.EmailAddress),
+			DisplayName:  aws.ToString(g.Grantee.DisplayName),
+			Permission:   g.Permission,
+		})
+	}
+	return acl
+}
+
+// grantSet maps each grant to its permission, keyed by grantee and permission, so that
+// two lists of grants can be compared with diffValues
+func grantSet(grants []types.Grant) map[string]string {
+	set := map[string]string{}
+	for _, g := range grants {
+		if g.Grantee == nil {
+			continue
+		}
+		var grantee string
+		switch {
+		case g.Grantee.ID != nil:
+			grantee = "id=" + *g.Grantee.ID
+		case g.Grantee.URI != nil:
+			grantee = "uri=" + *g.Grantee.URI
+		case g.Grantee.EmailAddress != nil:
+			grantee = "email=" + *g.Grantee.EmailAddress
+		default:
+			continue
+		}
+		set[grantee+" "+string(g.Permission)] = string(g.Permission)
+	}
+	return set
+}
+
+// s3Grants validates the grants and converts them to S3 grants.
+// A nil ACL yields no grants.
+func (a *ObjectACL) s3Grants() ([]types.Grant, error) {
+	if a == nil {
+		return nil, nil
+	}
+	var grants []types.Grant
+	for i, g := range a.Grants {
+		grantee := &types.Grantee{Type: g.GranteeType}
+		switch {
+		case g.ID != "" && g.URI == "" && g.EmailAddress == "":
+			grantee.ID = aws.String(g.ID)
+			if grantee.Type == "" {
+				grantee.Type = types.TypeCanonicalUser
+			}
+		case g.URI != "" && g.ID == "" && g.EmailAddress == "":
+			grantee.URI = aws.String(g.URI)
+			if grantee.Type == "" {
+				grantee.Type = types.TypeGroup
+			}
+		case g.EmailAddress != "" && g.ID == "" && g.URI == "":
+			grantee.EmailAddress = aws.String(g.EmailAddress)
+			if grantee.Type == "" {
+				grantee.Type = types.TypeAmazonCustomerByEmail
+			}
+		default:
+			return nil, fmt.Errorf("invalid grant %d: exactly one of ID, URI and EmailAddress must be set", i)
+		}
+		if g.DisplayName != "" {
+			grantee.DisplayName = aws.String(g.DisplayName)
+		}
+		if g.Permission == "" {
+			return nil, fmt.Errorf("invalid grant %d: permission is not set", i)
+		}
+		grants = append(grants, types.Grant{Grantee: grantee, Permission: g.Permission})
+	}
+	return grants, nil
+}
@@ -0,0 +1,119 @@
+package overwrite
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test the callback can inspect and edit the preserved grants
+func TestOverwrite_EditACL(t *testing.T) {
+	var putInput *s3.PutObjectInput
+	var aclInput *s3.PutObjectAclInput
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("test content"))}, nil
+		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{
+				Owner: &types.Owner{ID: aws.String("owner-id"), DisplayName: aws.String("owner")},
+				Grants: []types.Grant{
+					{
+						Grantee:    &types.Grantee{Type: types.TypeCanonicalUser, ID: aws.String("owner-id")},
+						Permission: types.PermissionFullControl,
+					},
+					{
+						Grantee:    &types.Grantee{Type: types.TypeGroup, URI: aws.String(AllUsersURI)},
+						Permission: types.PermissionRead,
+					},
+				},
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putInput = input
+			return &s3.PutObjectOutput{}, nil
+		},
+		putObjectAclFunc: func(ctx context.Context, input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+			aclInput = input
+			return &s3.PutObjectAclOutput{}, nil
+		},
+	}
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		if info.ACL == nil || info.ACL.Owner.ID != "owner-id" || len(info.ACL.Grants) != 2 {
+			t.Fatalf("ACL not exposed, got %+v", info.ACL)
+		}
+		if g := info.ACL.Grants[1]; g.GranteeType != types.TypeGroup || g.URI != AllUsersURI || g.Permission != types.PermissionRead {
+			t.Errorf("Unexpected grant %+v", g)
+		}
+
+		// Drop public read and add a partner account
+		grants := info.ACL.Grants[:0]
+		for _, g := range info.ACL.Grants {
+			if g.URI != AllUsersURI {
+				grants = append(grants, g)
+			}
+		}
+		info.ACL.Grants = append(grants,
+			Grant{ID: "partner-id", Permission: types.PermissionRead},
+			Grant{ID: "partner-id", Permission: types.PermissionWrite},
+		)
+		return srcFilePath, false, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if aws.ToString(putInput.GrantRead) != `id="partner-id"` {
+		t.Errorf("Expected partner READ grant, got %v", aws.ToString(putInput.GrantRead))
+	}
+	if aws.ToString(putInput.GrantFullControl) != `id="owner-id"` {
+		t.Errorf("Expected owner FULL_CONTROL grant, got %v", aws.ToString(putInput.GrantFullControl))
+	}
+	if aclInput == nil || aws.ToString(aclInput.GrantWrite) != `id="partner-id"` {
+		t.Error("Expected the added WRITE grant to be applied with PutObjectAcl")
+	}
+	if len(result.Grants) != 3 || !result.ACLRestored {
+		t.Errorf("Unexpected result grants %v", result.Grants)
+	}
+}
+
+// Test grants are validated and converted back to S3 grants
+func TestObjectACL_S3Grants(t *testing.T) {
+	grants, err := (*ObjectACL)(nil).s3Grants()
+	if err != nil || grants != nil {
+		t.Errorf("Expected no grants for a nil ACL, got %v, %v", grants, err)
+	}
+
+	acl := &ObjectACL{Grants: []Grant{
+		{ID: "id", Permission: types.PermissionRead},
+		{URI: LogDeliveryURI, Permission: types.PermissionWrite},
+		{EmailAddress: "user@example.com", Permission: types.PermissionReadAcp},
+	}}
+	grants, err = acl.s3Grants()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	expected := []types.Type{types.TypeCanonicalUser, types.TypeGroup, types.TypeAmazonCustomerByEmail}
+	for i, g := range grants {
+		if g.Grantee.Type != expected[i] {
+			t.Errorf("Grant %d: expected type %s, got %s", i, expected[i], g.Grantee.Type)
+		}
+	}
+
+	invalid := []Grant{
+		{Permission: types.PermissionRead},
+		{ID: "id", URI: AllUsersURI, Permission: types.PermissionRead},
+		{ID: "id"},
+	}
+	for _, g := range invalid {
+		if _, err := (&ObjectACL{Grants: []Grant{g}}).s3Grants(); err == nil {
+			t.Errorf("Expected error for grant %+v", g)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ErrBackupIsSource is returned (wrapped) when a BackupLocation resolves to the object
+// being overwritten, so the backup would be destroyed by the overwrite
+var ErrBackupIsSource = errors.New("backup location is the object itself")
+
+// BackupLocation says where WithBackup copies the original object.
+// The backup key is Prefix followed by KeyTemplate, in which {bucket}, {key},
+// {date} (2006-01-02) and {timestamp} (20060102T150405Z) are replaced; the
+// default template is "{key}". Bucket defaults to the object's bucket, so at least one
+// of Bucket, Prefix and KeyTemplate must differ from the object's location.
+type BackupLocation struct {
+	Bucket      string
+	Prefix      string
+	KeyTemplate string
+}
+
+// resolve returns the backup bucket and key for an object. It fails with
+// ErrBackupIsSource if they are the object's own.
+func (l BackupLocation) resolve(bucket, key string, now time.Time) (string, string, error) {
+	backupBucket := l.Bucket
+	if backupBucket == "" {
+		backupBucket = bucket
+	}
+	template := l.KeyTemplate
+	if template == "" {
+		template = "{key}"
+	}
+	now = now.UTC()
+	backupKey := strings.NewReplacer(
+		"{bucket}", bucket,
+		"{key}", key,
+		"{date}", now.Format("2006-01-02"),
+		"{timestamp}", now.Format("20060102T150405Z"),
+	).Replace(template)
+	backupKey = l.Prefix + backupKey
+	if backupBucket == bucket && backupKey == key {
+		return "", "", fmt.Errorf("%w: s3://%s/%s", ErrBackupIsSource, bucket, key)
+	}
+	return backupBucket, backupKey, nil
+}
+
+// backupObject copies the original object to the backup location with its metadata,
+// tags and ACL. It must run before the object is overwritten.
+func backupObject(ctx context.Context, client S3Client, bucket, key string, src *source, o *options, result *OverwriteResult) error {
+	cc, ok := client.(CopyClient)
+	if !ok {
+		return stageError(StageBackup, errors.New("failed to back up object: the client does not implement CopyClient"))
+	}
+	backupBucket, backupKey, err := o.backup.resolve(bucket, key, time.Now())
+	if err != nil {
+		return stageError(StageBackup, fmt.Errorf("failed to back up object: %w", err))
+	}
+
+	// The backup keeps the original ACL even when a simple ACL replaces it
+	bo := *o
+	bo.cannedACL = ""
+
+	// Object Lock settings are not carried over, so backups can be cleaned up
+	bsrc := *src
+	bsrc.lock = objectLock{}
+
+	backupStart := time.Now()
+	backup, err := copyWithAttributes(ctx, cc, bucket, key, &bsrc, backupBucket, backupKey, &bo)
+	result.Timings.Backup = time.Since(backupStart)
+	if err != nil {
+		return stageError(StageBackup, fmt.Errorf("failed to back up object: %w", err))
+	}
+	result.BackupBucket = backupBucket
+	result.BackupKey = backupKey
+	result.BackupVersionId = backup.NewVersionId
+	return nil
+}
+
+// Restore copies a backup made with WithBackup back over bucket/key, with the
+// backup's metadata, tags, ACL and Object Lock settings. Options for encryption,
+// multipart copy and the ACL apply; WithConditionalWrite does not.
+func Restore(
+	ctx context.Context,
+	client CopyClient,
+	backupBucket string,
+	backupKey string,
+	bucket string,
+	key string,
+	opts ...Option,
+) (*OverwriteResult, error) {
+	o := newOptions(opts)
+	result := &OverwriteResult{Bucket: bucket, Key: key, Attempts: 1}
+	err := restore(ctx, client, backupBucket, backupKey, nil, bucket, key, o, result)
+	return result, overwriteError(err, result)
+}
+
+// restore copies version versionID of srcBucket/srcKey (the current version if nil)
+// over bucket/key with its attributes
+func restore(
+	ctx context.Context,
+	client CopyClient,
+	srcBucket string,
+	srcKey string,
+	versionID *string,
+	bucket string,
+	key string,
+	o *options,
+	result *OverwriteResult,
+) error {
+	// OldETag and OldVersionId describe the object being replaced, not the source
+	oldETag, oldVersionID := result.OldETag, result.OldVersionId
+	src, err := headSource(ctx, client, srcBucket, srcKey, versionID, o, result)
+	result.OldETag, result.OldVersionId = oldETag, oldVersionID
+	if err != nil {
+		return err
+	}
+
+	uploadStart := time.Now()
+	restored, err := copyWithAttributes(ctx, client, srcBucket, srcKey, src, bucket, key, o)
+	result.Timings.Upload = time.Since(uploadStart)
+	if err != nil {
+		return fmt.Errorf("failed to restore object: %w", err)
+	}
+	result.Status = StatusWritten
+	result.NewETag = restored.NewETag
+	result.NewVersionId = restored.NewVersionId
+	result.Tags = restored.Tags
+	result.Grants = restored.Grants
+	result.CannedACL = restored.CannedACL
+	result.ACLRestored = restored.ACLRestored
+	return nil
+}
+
+// copyWithAttributes copies src, read from bucket/key, to dstBucket/dstKey with its
+// metadata, headers, tags, grants, storage class, encryption and Object Lock settings.
+// The copy only succeeds if src has not changed since it was read.
+func copyWithAttributes(
+	ctx context.Context,
+	client CopyClient,
+	bucket string,
+	key string,
+	src *source,
+	dstBucket string,
+	dstKey string,
+	o *options,
+) (*OverwriteResult, error) {
+	// Copies keep the source's attributes as they are
+	co := *o
+	co.conditionalWrite = false
+	co.stamp = ""
+	result := &OverwriteResult{Bucket: dstBucket, Key: dstKey}
+
+	tags, err := fetchTags(ctx, client, bucket, key, src.getResp.VersionId, o)
+	if err != nil {
+		return result, err
+	}
+	acl, err := getACL(ctx, client, bucket, key, src.getResp.VersionId, &co)
+	if err != nil {
+		return result, err
+	}
+	grants, err := acl.s3Grants()
+	if err != nil {
+		return result, err
+	}
+
+	info := newObjectInfo(dstBucket, dstKey, src.getResp, tags, acl)
+	putInput := buildPutInput(dstBucket, dstKey, src, info, tags, grants, &co, result)
+	from := copyFrom{
+		source:  copySourceFor(bucket, key, src.getResp.VersionId),
+		ifMatch: src.getResp.ETag,
+		size:    aws.ToInt64(src.getResp.ContentLength),
+	}
+	if err := copyObject(ctx, client, putInput, from, &co, result); err != nil {
+		return result, stageError(StagePut, err)
+	}
+	return result, restoreWriteGrants(ctx, client, dstBucket, dstKey, grants, o, result)
+}
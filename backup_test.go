@@ -0,0 +1,181 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test the original object is copied to the backup location before PutObject
+func TestOverwrite_Backup(t *testing.T) {
+	client := newMockClient(taggedObject())
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "dir/file.txt", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		info.Metadata["key1"] = aws.String("changed")
+		return srcFilePath, false, nil
+	}, WithBackup(BackupLocation{Bucket: "backup-bucket", Prefix: "backup/"}), WithCannedACL("public-read"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.copyInputs) != 1 || len(client.putInputs) != 1 {
+		t.Fatalf("Expected one copy and one put, got %d and %d", len(client.copyInputs), len(client.putInputs))
+	}
+	in := client.copyInputs[0]
+	if aws.ToString(in.Bucket) != "backup-bucket" || aws.ToString(in.Key) != "backup/dir/file.txt" {
+		t.Errorf("Unexpected backup destination %s/%s", aws.ToString(in.Bucket), aws.ToString(in.Key))
+	}
+	if aws.ToString(in.CopySource) != "test-bucket/dir/file.txt" || aws.ToString(in.CopySourceIfMatch) != `"old-etag"` {
+		t.Errorf("Unexpected copy source %s if-match %s", aws.ToString(in.CopySource), aws.ToString(in.CopySourceIfMatch))
+	}
+	if in.Metadata["key1"] != "value1" || aws.ToString(in.ContentType) != "text/plain" {
+		t.Errorf("Original metadata not kept, got %v", in.Metadata)
+	}
+	if aws.ToString(in.Tagging) != "tag1=value1" {
+		t.Errorf("Original tags not kept, got %v", aws.ToString(in.Tagging))
+	}
+	if aws.ToString(in.GrantRead) != `id="123456"` || in.ACL != "" {
+		t.Errorf("Original ACL not kept, got %v %v", aws.ToString(in.GrantRead), in.ACL)
+	}
+	if client.putInputs[0].Metadata["key1"] != "changed" || client.putInputs[0].ACL != types.ObjectCannedACLPublicRead {
+		t.Error("Expected the callback's changes on the new object")
+	}
+	if result.BackupBucket != "backup-bucket" || result.BackupKey != "backup/dir/file.txt" || aws.ToString(result.BackupVersionId) != "v2" {
+		t.Errorf("Unexpected backup in result %+v", result)
+	}
+
+	t.Run("skipped objects are not backed up", func(t *testing.T) {
+		client.copyInputs = nil
+		_, err := Overwrite(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			return "", false, nil
+		}, WithBackup(BackupLocation{Prefix: "backup/"}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(client.copyInputs) != 0 {
+			t.Error("Expected no backup")
+		}
+	})
+
+	t.Run("backup onto the object itself", func(t *testing.T) {
+		client.putInputs = nil
+		client.copyInputs = nil
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			return srcFilePath, false, nil
+		}, WithBackup(BackupLocation{}))
+		if !errors.Is(err, ErrBackupIsSource) {
+			t.Errorf("Expected ErrBackupIsSource, got %v", err)
+		}
+		if len(client.putInputs) != 0 || len(client.copyInputs) != 0 || result.BackupKey != "" {
+			t.Error("Nothing must be written when the backup is the object itself")
+		}
+	})
+
+	t.Run("locked objects are backed up without the lock", func(t *testing.T) {
+		client.putInputs = nil
+		client.copyInputs = nil
+		getObject := client.getObjectFunc
+		defer func() { client.getObjectFunc = getObject }()
+		client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			resp, err := getObject(ctx, input)
+			resp.ObjectLockLegalHoldStatus = types.ObjectLockLegalHoldStatusOn
+			return resp, err
+		}
+		_, err := Overwrite(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			return srcFilePath, false, nil
+		}, WithBackup(BackupLocation{Prefix: "backup/"}))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if client.copyInputs[0].ObjectLockLegalHoldStatus != "" || client.putInputs[0].ObjectLockLegalHoldStatus != types.ObjectLockLegalHoldStatusOn {
+			t.Error("Expected the lock on the new object only")
+		}
+	})
+
+	t.Run("client without CopyObject", func(t *testing.T) {
+		client.putInputs = nil
+		_, err := Overwrite(context.Background(), struct{ S3Client }{client}, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			return srcFilePath, false, nil
+		}, WithBackup(BackupLocation{Prefix: "backup/"}))
+		if err == nil || !strings.Contains(err.Error(), "CopyClient") {
+			t.Errorf("Expected a CopyClient error, got %v", err)
+		}
+		if len(client.putInputs) != 0 {
+			t.Error("The object must not be overwritten without a backup")
+		}
+	})
+}
+
+// Test backup keys are built from the location's template
+func TestBackupLocation_Resolve(t *testing.T) {
+	now := time.Date(2024, 3, 5, 6, 7, 8, 0, time.UTC)
+	tests := []struct {
+		loc     BackupLocation
+		bucket  string
+		key     string
+		wantErr bool
+	}{
+		{BackupLocation{}, "", "", true},
+		{BackupLocation{KeyTemplate: "{key}"}, "", "", true},
+		{BackupLocation{Bucket: "src", KeyTemplate: "a/b.txt"}, "", "", true},
+		{BackupLocation{Bucket: "dst"}, "dst", "a/b.txt", false},
+		{BackupLocation{Prefix: "backup/"}, "src", "backup/a/b.txt", false},
+		{BackupLocation{Bucket: "dst", KeyTemplate: "backup/{date}/{key}"}, "dst", "backup/2024-03-05/a/b.txt", false},
+		{BackupLocation{KeyTemplate: "{bucket}/{key}.{timestamp}"}, "src", "src/a/b.txt.20240305T060708Z", false},
+	}
+	for _, tt := range tests {
+		bucket, key, err := tt.loc.resolve("src", "a/b.txt", now)
+		if tt.wantErr != errors.Is(err, ErrBackupIsSource) {
+			t.Errorf("%+v: unexpected error %v", tt.loc, err)
+		}
+		if bucket != tt.bucket || key != tt.key {
+			t.Errorf("%+v: expected %s/%s, got %s/%s", tt.loc, tt.bucket, tt.key, bucket, key)
+		}
+	}
+}
+
+// Test Restore copies the backup over the key with the backup's attributes
+func TestRestore(t *testing.T) {
+	client := newMockClient(taggedObject())
+	retainUntil := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	client.headObjectFunc = func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+		if aws.ToString(input.Bucket) != "backup-bucket" || aws.ToString(input.Key) != "backup/key" {
+			t.Errorf("Unexpected HeadObject %s/%s", aws.ToString(input.Bucket), aws.ToString(input.Key))
+		}
+		return &s3.HeadObjectOutput{
+			ContentLength: aws.Int64(8),
+			ContentType:   aws.String("text/plain"),
+			ETag:          aws.String(`"backup-etag"`),
+			Metadata:      map[string]string{"key1": "value1"},
+
+			ObjectLockMode:            types.ObjectLockModeGovernance,
+			ObjectLockRetainUntilDate: aws.Time(retainUntil),
+			ObjectLockLegalHoldStatus: types.ObjectLockLegalHoldStatusOn,
+		}, nil
+	}
+
+	result, err := Restore(context.Background(), client, "backup-bucket", "backup/key", "test-bucket", "key")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	in := client.copyInput
+	if aws.ToString(in.Bucket) != "test-bucket" || aws.ToString(in.Key) != "key" || aws.ToString(in.CopySource) != "backup-bucket/backup/key" {
+		t.Errorf("Unexpected copy %s/%s from %s", aws.ToString(in.Bucket), aws.ToString(in.Key), aws.ToString(in.CopySource))
+	}
+	if in.Metadata["key1"] != "value1" || aws.ToString(in.Tagging) != "tag1=value1" || aws.ToString(in.GrantRead) != `id="123456"` {
+		t.Error("Backup attributes not restored")
+	}
+	if in.ObjectLockMode != types.ObjectLockModeGovernance || !aws.ToTime(in.ObjectLockRetainUntilDate).Equal(retainUntil) ||
+		in.ObjectLockLegalHoldStatus != types.ObjectLockLegalHoldStatusOn {
+		t.Errorf("Object Lock not restored, got %s until %v, legal hold %s", in.ObjectLockMode, in.ObjectLockRetainUntilDate, in.ObjectLockLegalHoldStatus)
+	}
+	if result.Status != StatusWritten || aws.ToString(result.NewETag) != `"copy-etag"` || result.OldETag != nil {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
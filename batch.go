@@ -0,0 +1,251 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const defaultWorkers = 4
+
+// ErrTooManyFailures is returned (wrapped) when a batch stops because the number of
+// failed objects reached the limit set with WithMaxFailures
+var ErrTooManyFailures = errors.New("too many failures")
+
+// ListClient is the optional interface for listing objects.
+// *s3.Client implements it.
+type ListClient interface {
+	ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error)
+}
+
+// BatchClient is the interface required by OverwritePrefix
+type BatchClient interface {
+	S3Client
+	ListClient
+}
+
+// KeyError is the error that made the overwrite of a single key fail
+type KeyError struct {
+	Key string
+	Err error
+}
+
+func (e KeyError) Error() string {
+	return e.Key + ": " + e.Err.Error()
+}
+
+func (e KeyError) Unwrap() error {
+	return e.Err
+}
+
+// BatchSummary describes what a batch overwrite did
+type BatchSummary struct {
+	Processed int // objects handed to Overwrite
+	Filtered  int // objects excluded by WithFilter
+	Resumed   int // objects finished by an earlier run (see WithCheckpoint)
+	Written   int
+	Planned   int // objects that would be written (see WithDryRun)
+	Unchanged int // objects left alone because nothing changed (see WithSkipUnchanged)
+	Skipped   int
+	Failed    int
+	Errors    []KeyError
+}
+
+// OverwritePrefix runs Overwrite on every object under prefix, using a pool of workers
+// (see WithWorkers). WithFilter selects which objects are processed, and WithCheckpoint
+// makes the batch resumable. Objects that fail are recorded in the summary and the batch carries
+// on, until WithMaxFailures is reached or ctx is cancelled. The summary is returned
+// along with any error.
+func OverwritePrefix(
+	ctx context.Context,
+	client BatchClient,
+	bucket string,
+	prefix string,
+	callback OverwriteCallback,
+	opts ...Option,
+) (*BatchSummary, error) {
+	o := newOptions(opts)
+	return runBatch(ctx, client, bucket, prefix, o, func(key string) (*OverwriteResult, error) {
+		return Overwrite(ctx, client, bucket, key, callback, opts...)
+	})
+}
+
+// runBatch lists the objects under prefix and calls process for each selected key
+// from the configured number of workers
+func runBatch(
+	ctx context.Context,
+	client BatchClient,
+	bucket string,
+	prefix string,
+	o *options,
+	process func(key string) (*OverwriteResult, error),
+) (*BatchSummary, error) {
+	summary := &BatchSummary{}
+	if err := checkFilter(client, o); err != nil {
+		return summary, err
+	}
+
+	var cp *checkpointer
+	if o.checkpoint != "" {
+		// Planned objects are not written, so they must not be checkpointed as finished
+		if o.dryRun {
+			return summary, errors.New("WithCheckpoint cannot be combined with WithDryRun")
+		}
+		var err error
+		if cp, err = loadCheckpoint(o.checkpoint, bucket, prefix); err != nil {
+			return summary, err
+		}
+	}
+	startToken, listed := cp.startToken()
+
+	// stop ends the listing without cancelling objects already in progress
+	stop, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var mu sync.Mutex
+	var batchErr error
+	stopWith := func(err error) {
+		if batchErr == nil {
+			batchErr = err
+			cancel()
+		}
+	}
+	record := func(key string, result *OverwriteResult, err error) {
+		// Failed and interrupted objects are left for the next run
+		if err == nil {
+			cp.finish(key)
+		} else {
+			cp.fail(key)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err := cp.failure(); err != nil {
+			stopWith(err)
+		}
+		summary.Processed++
+		switch {
+		case err != nil:
+			summary.Failed++
+			summary.Errors = append(summary.Errors, KeyError{Key: key, Err: err})
+			if o.maxFailures > 0 && summary.Failed >= o.maxFailures {
+				stopWith(fmt.Errorf("%w: %d objects failed", ErrTooManyFailures, summary.Failed))
+			}
+		case result.Status == StatusWritten:
+			summary.Written++
+		case result.Status == StatusPlanned:
+			summary.Planned++
+		case result.Status == StatusUnchanged:
+			summary.Unchanged++
+		default:
+			summary.Skipped++
+		}
+	}
+
+	filtered := func(key string) {
+		cp.finish(key)
+		mu.Lock()
+		defer mu.Unlock()
+		summary.Filtered++
+	}
+
+	objects := make(chan types.Object)
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for obj := range objects {
+				if stop.Err() != nil {
+					// The batch is stopping; leave the object for the next run
+					continue
+				}
+				key := aws.ToString(obj.Key)
+				cp.begin(key)
+				selected, err := selectObject(ctx, client, bucket, obj, o)
+				if err != nil {
+					record(key, nil, &OverwriteError{Stage: StageDecide, Bucket: bucket, Key: key, Err: fmt.Errorf("failed to filter object: %w", err)})
+					continue
+				}
+				if !selected {
+					filtered(key)
+					continue
+				}
+				result, err := process(key)
+				record(key, result, err)
+			}
+		}()
+	}
+
+	// Objects that failed in an earlier run go first
+	var listErr error
+	if sendObjects(stop, cp.retryObjects(), objects) && !listed {
+		listErr = listObjects(stop, client, bucket, prefix, startToken, cp, objects)
+	}
+	close(objects)
+	wg.Wait()
+	cp.flush()
+	summary.Resumed = cp.resumedCount()
+
+	if batchErr != nil {
+		return summary, batchErr
+	}
+	if err := cp.failure(); err != nil {
+		return summary, err
+	}
+	if err := ctx.Err(); err != nil {
+		return summary, err
+	}
+	if listErr != nil {
+		return summary, listErr
+	}
+	if summary.Failed > 0 {
+		// Keep the checkpoint so that a later run retries the failed objects
+		return summary, nil
+	}
+	return summary, cp.remove()
+}
+
+// sendObjects sends objects to out and reports whether all were sent before ctx was done
+func sendObjects(ctx context.Context, objects []types.Object, out chan<- types.Object) bool {
+	for _, obj := range objects {
+		select {
+		case out <- obj:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// listObjects sends every object under prefix to objects, starting from token, until
+// the listing ends or ctx is done. Objects the checkpoint has finished are skipped.
+func listObjects(ctx context.Context, client ListClient, bucket, prefix, token string, cp *checkpointer, objects chan<- types.Object) error {
+	for {
+		input := &s3.ListObjectsV2Input{
+			Bucket: aws.String(bucket),
+			Prefix: aws.String(prefix),
+		}
+		if token != "" {
+			input.ContinuationToken = aws.String(token)
+		}
+		page, err := client.ListObjectsV2(ctx, input)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("failed to list objects: %w", err)
+		}
+
+		next := aws.ToString(page.NextContinuationToken)
+		last := !aws.ToBool(page.IsTruncated) || next == ""
+		if !sendObjects(ctx, cp.addPage(token, next, last, page.Contents), objects) || last {
+			return nil
+		}
+		token = next
+	}
+}
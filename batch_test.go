@@ -0,0 +1,107 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Test every listed object is processed with bounded concurrency
+func TestOverwritePrefix(t *testing.T) {
+	var running, peak int32
+	client := newMockClient(mockObject{body: "test content"})
+	client.keys = append(numberedKeys("data/", 25), "data/bad.txt")
+	client.getObjectErrors = map[string]error{"data/bad.txt": errors.New("access denied")}
+
+	summary, err := OverwritePrefix(context.Background(), client, "test-bucket", "data/", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+
+		if strings.HasSuffix(info.Key, "0.txt") {
+			return "", false, nil
+		}
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"), WithWorkers(3))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.Processed != 26 || summary.Written != 22 || summary.Skipped != 3 || summary.Failed != 1 {
+		t.Errorf("Unexpected summary %+v", summary)
+	}
+	if len(summary.Errors) != 1 || summary.Errors[0].Key != "data/bad.txt" {
+		t.Errorf("Expected an error for data/bad.txt, got %v", summary.Errors)
+	}
+	if len(client.listed) != 3 || aws.ToString(client.listed[0].Prefix) != "data/" {
+		t.Errorf("Expected 3 list pages for the prefix, got %d", len(client.listed))
+	}
+	if peak > 3 {
+		t.Errorf("Expected at most 3 workers, saw %d", peak)
+	}
+}
+
+// Test the batch stops at the failure limit and on cancellation
+func TestOverwritePrefix_Stop(t *testing.T) {
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}
+
+	t.Run("max failures", func(t *testing.T) {
+		client := newMockClient(mockObject{body: "test content"})
+		client.keys = numberedKeys("bad/", 50)
+		client.getObjectErrors = map[string]error{}
+		for _, key := range client.keys {
+			client.getObjectErrors[key] = errors.New("access denied")
+		}
+
+		summary, err := OverwritePrefix(context.Background(), client, "test-bucket", "", callback,
+			WithCannedACL("private"), WithWorkers(2), WithMaxFailures(3))
+
+		if !errors.Is(err, ErrTooManyFailures) {
+			t.Fatalf("Expected ErrTooManyFailures, got %v", err)
+		}
+		if summary.Failed < 3 || summary.Failed > 5 {
+			t.Errorf("Expected the batch to stop after 3 failures, got %d", summary.Failed)
+		}
+		var keyErr KeyError
+		if !errors.As(summary.Errors[0], &keyErr) || !strings.Contains(keyErr.Error(), "access denied") {
+			t.Errorf("Unexpected key error %v", summary.Errors[0])
+		}
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		var calls int32
+		client := newMockClient(mockObject{body: "test content"})
+		client.keys = numberedKeys("data/", 100)
+		getObject := client.getObjectFunc
+		client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			if atomic.AddInt32(&calls, 1) == 5 {
+				cancel()
+			}
+			return getObject(ctx, input)
+		}
+
+		summary, err := OverwritePrefix(ctx, client, "test-bucket", "", callback, WithCannedACL("private"), WithWorkers(1))
+
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected context.Canceled, got %v", err)
+		}
+		if summary.Processed >= 100 {
+			t.Errorf("Expected the batch to stop early, processed %d", summary.Processed)
+		}
+	})
+}
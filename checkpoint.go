@@ -0,0 +1,339 @@
+package overwrite
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// checkpointInterval is how often the checkpoint is saved while the batch runs
+const checkpointInterval = time.Second
+
+// checkpointFile is the on-disk format of a batch checkpoint
+type checkpointFile struct {
+	Bucket string `json:"bucket"`
+	Prefix string `json:"prefix"`
+	// ContinuationToken lists the oldest page that still has unfinished keys
+	ContinuationToken string `json:"continuation_token,omitempty"`
+	ListingComplete   bool   `json:"listing_complete,omitempty"`
+	// Completed holds the finished keys from ContinuationToken onwards
+	Completed []string `json:"completed"`
+	InFlight  []string `json:"in_flight"`
+	// Failed holds the objects that failed, to be processed first by the next run
+	Failed []checkpointObject `json:"failed,omitempty"`
+}
+
+// checkpointObject is a failed object with the listing data that WithFilter checks
+type checkpointObject struct {
+	Key          string     `json:"key"`
+	Size         *int64     `json:"size,omitempty"`
+	LastModified *time.Time `json:"last_modified,omitempty"`
+	StorageClass string     `json:"storage_class,omitempty"`
+}
+
+// checkpointPage is a listed page that still has unfinished keys
+type checkpointPage struct {
+	token     string
+	pending   map[string]types.Object
+	completed []string
+}
+
+// checkpointer tracks batch progress and saves it at most every checkpointInterval,
+// and once more by flush. All methods are no-ops on a nil checkpointer.
+type checkpointer struct {
+	path   string
+	bucket string
+	prefix string
+
+	mu              sync.Mutex
+	pages           []*checkpointPage
+	keyPage         map[string]*checkpointPage
+	nextToken       string
+	listingComplete bool
+	inFlight        map[string]bool
+	failed          map[string]types.Object
+	done            map[string]bool // keys finished by an earlier run
+	retried         map[string]bool // keys that failed in an earlier run
+	resumed         int
+	dirty           bool
+	saved           time.Time
+	err             error
+}
+
+// loadCheckpoint reads the checkpoint at path, or starts a new one if it does not exist
+func loadCheckpoint(path, bucket, prefix string) (*checkpointer, error) {
+	c := &checkpointer{
+		path:     path,
+		bucket:   bucket,
+		prefix:   prefix,
+		keyPage:  map[string]*checkpointPage{},
+		inFlight: map[string]bool{},
+		failed:   map[string]types.Object{},
+		done:     map[string]bool{},
+		retried:  map[string]bool{},
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	var f checkpointFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if f.Bucket != bucket || f.Prefix != prefix {
+		return nil, fmt.Errorf("checkpoint %s belongs to s3://%s/%s", path, f.Bucket, f.Prefix)
+	}
+	c.nextToken = f.ContinuationToken
+	c.listingComplete = f.ListingComplete
+	for _, key := range f.Completed {
+		c.done[key] = true
+	}
+	for _, obj := range f.Failed {
+		c.failed[obj.Key] = types.Object{
+			Key:          aws.String(obj.Key),
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			StorageClass: types.ObjectStorageClass(obj.StorageClass),
+		}
+		c.retried[obj.Key] = true
+	}
+	return c, nil
+}
+
+// retryObjects returns the objects that failed in an earlier run, sorted by key.
+// The listing skips them, so that they are processed once.
+func (c *checkpointer) retryObjects() []types.Object {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var objects []types.Object
+	for key := range c.retried {
+		objects = append(objects, c.failed[key])
+	}
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.ToString(objects[i].Key) < aws.ToString(objects[j].Key)
+	})
+	return objects
+}
+
+// startToken returns the continuation token to resume listing from, and whether the
+// listing had already finished
+func (c *checkpointer) startToken() (string, bool) {
+	if c == nil {
+		return "", false
+	}
+	return c.nextToken, c.listingComplete
+}
+
+// addPage records a listed page and returns the objects that still need processing.
+// next is the token of the following page, and last reports whether there is none.
+func (c *checkpointer) addPage(token, next string, last bool, objects []types.Object) []types.Object {
+	if c == nil {
+		return objects
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	page := &checkpointPage{token: token, pending: map[string]types.Object{}}
+	var todo []types.Object
+	for _, obj := range objects {
+		key := aws.ToString(obj.Key)
+		if c.done[key] {
+			page.completed = append(page.completed, key)
+			c.resumed++
+			continue
+		}
+		if c.retried[key] {
+			continue
+		}
+		page.pending[key] = obj
+		c.keyPage[key] = page
+		todo = append(todo, obj)
+	}
+	c.pages = append(c.pages, page)
+	c.nextToken = next
+	c.listingComplete = last
+	c.advance()
+	return todo
+}
+
+// begin marks key as in flight
+func (c *checkpointer) begin(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight[key] = true
+}
+
+// finish marks key as completed
+func (c *checkpointer) finish(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inFlight, key)
+	delete(c.failed, key)
+	if page := c.keyPage[key]; page != nil {
+		delete(page.pending, key)
+		delete(c.keyPage, key)
+		page.completed = append(page.completed, key)
+	}
+	c.advance()
+}
+
+// fail moves key from its page to the failed objects, so that the listing can move
+// past it and a resumed run processes it first
+func (c *checkpointer) fail(key string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.inFlight, key)
+	if page := c.keyPage[key]; page != nil {
+		c.failed[key] = page.pending[key]
+		delete(page.pending, key)
+		delete(c.keyPage, key)
+	}
+	c.advance()
+}
+
+// advance drops finished pages from the front and saves the checkpoint if the last
+// save is older than checkpointInterval. c.mu must be held.
+func (c *checkpointer) advance() {
+	for len(c.pages) > 0 && len(c.pages[0].pending) == 0 {
+		c.pages = c.pages[1:]
+	}
+	c.dirty = true
+	if time.Since(c.saved) >= checkpointInterval {
+		c.flushLocked()
+	}
+}
+
+// flush saves the checkpoint if it changed since the last save
+func (c *checkpointer) flush() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.flushLocked()
+}
+
+// flushLocked is flush with c.mu held
+func (c *checkpointer) flushLocked() {
+	if !c.dirty {
+		return
+	}
+	if err := c.save(); err != nil && c.err == nil {
+		c.err = err
+	}
+	c.dirty = false
+	c.saved = time.Now()
+}
+
+// save writes the checkpoint atomically. c.mu must be held.
+func (c *checkpointer) save() error {
+	f := checkpointFile{
+		Bucket:            c.bucket,
+		Prefix:            c.prefix,
+		ContinuationToken: c.nextToken,
+		ListingComplete:   c.listingComplete && len(c.pages) == 0,
+		Completed:         []string{},
+		InFlight:          []string{},
+	}
+	if len(c.pages) > 0 {
+		f.ContinuationToken = c.pages[0].token
+	}
+	for _, page := range c.pages {
+		f.Completed = append(f.Completed, page.completed...)
+	}
+	for key := range c.inFlight {
+		f.InFlight = append(f.InFlight, key)
+	}
+	sort.Strings(f.InFlight)
+	for key, obj := range c.failed {
+		f.Failed = append(f.Failed, checkpointObject{
+			Key:          key,
+			Size:         obj.Size,
+			LastModified: obj.LastModified,
+			StorageClass: string(obj.StorageClass),
+		})
+	}
+	sort.Slice(f.Failed, func(i, j int) bool { return f.Failed[i].Key < f.Failed[j].Key })
+
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), ".checkpoint-*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+	return nil
+}
+
+// failure returns the first error saving the checkpoint
+func (c *checkpointer) failure() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+// resumedCount returns how many listed keys were skipped because an earlier run
+// finished them
+func (c *checkpointer) resumedCount() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.resumed
+}
+
+// remove deletes the checkpoint after the batch has finished
+func (c *checkpointer) remove() error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove checkpoint: %w", err)
+	}
+	return nil
+}
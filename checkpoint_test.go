@@ -0,0 +1,260 @@
+package overwrite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test an interrupted batch resumes without processing finished keys again
+func TestOverwritePrefix_Checkpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.checkpoint")
+	client := newMockClient(mockObject{body: "test content"})
+	client.keys = numberedKeys("data/", 25)
+
+	var mu sync.Mutex
+	counts := map[string]int{}
+	ctx, cancel := context.WithCancel(context.Background())
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		counts[info.Key]++
+		if len(counts) == 12 {
+			cancel()
+		}
+		return srcFilePath, false, nil
+	}
+
+	first, err := OverwritePrefix(ctx, client, "test-bucket", "data/", callback,
+		WithCannedACL("private"), WithWorkers(1), WithCheckpoint(path))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Expected a checkpoint file: %v", err)
+	}
+	var saved checkpointFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Bucket != "test-bucket" || saved.Prefix != "data/" || saved.ContinuationToken != "10" {
+		t.Errorf("Unexpected checkpoint %+v", saved)
+	}
+
+	second, err := OverwritePrefix(context.Background(), client, "test-bucket", "data/", callback,
+		WithCannedACL("private"), WithWorkers(3), WithCheckpoint(path))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(counts) != 25 {
+		t.Errorf("Expected all 25 keys to be processed, got %d", len(counts))
+	}
+	for key, n := range counts {
+		if n != 1 {
+			t.Errorf("Key %s processed %d times", key, n)
+		}
+	}
+	if first.Processed+second.Processed != 25 || second.Resumed != first.Processed-10 {
+		t.Errorf("Unexpected summaries %+v, %+v", first, second)
+	}
+	if aws.ToString(client.listed[len(client.listed)-2].ContinuationToken) != "10" {
+		t.Error("Expected the second run to resume listing from the checkpoint")
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the checkpoint to be removed after the batch finished")
+	}
+}
+
+// Test failed keys stay pending and are processed again when the batch resumes
+func TestOverwritePrefix_CheckpointFailures(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.checkpoint")
+	client := newMockClient(mockObject{body: "test content"})
+	client.keys = numberedKeys("data/", 25)
+
+	broken := map[string]bool{"data/003.txt": true, "data/005.txt": true}
+	counts := map[string]int{}
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		counts[info.Key]++
+		if broken[info.Key] {
+			return "", false, errors.New("broken")
+		}
+		return srcFilePath, false, nil
+	}
+
+	first, err := OverwritePrefix(context.Background(), client, "test-bucket", "data/", callback,
+		WithCannedACL("private"), WithWorkers(1), WithMaxFailures(2), WithCheckpoint(path))
+	if !errors.Is(err, ErrTooManyFailures) || first.Failed != 2 {
+		t.Fatalf("Expected the batch to stop after 2 failures, got %+v: %v", first, err)
+	}
+
+	// Fix the cause and resume
+	broken = nil
+	second, err := OverwritePrefix(context.Background(), client, "test-bucket", "data/", callback,
+		WithCannedACL("private"), WithWorkers(1), WithCheckpoint(path))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if counts["data/003.txt"] != 2 || counts["data/005.txt"] != 2 {
+		t.Errorf("Expected the failed keys to be retried, got %v", counts)
+	}
+	if second.Failed != 0 || second.Resumed != first.Processed-2 || second.Written != 25-second.Resumed {
+		t.Errorf("Unexpected summaries %+v, %+v", first, second)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("Expected the checkpoint to be removed after the batch finished")
+	}
+}
+
+// Test a batch with failures keeps its checkpoint
+func TestOverwritePrefix_CheckpointKeptOnFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.checkpoint")
+	client := newMockClient(mockObject{body: "test content"})
+	client.keys = append(numberedKeys("data/", 5), "data/bad.txt")
+	client.getObjectErrors = map[string]error{"data/bad.txt": errors.New("access denied")}
+
+	summary, err := OverwritePrefix(context.Background(), client, "test-bucket", "data/", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"), WithCheckpoint(path))
+	if err != nil || summary.Failed != 1 {
+		t.Fatalf("Expected one failure, got %+v: %v", summary, err)
+	}
+	reloaded, err := loadCheckpoint(path, "test-bucket", "data/")
+	if err != nil {
+		t.Fatalf("Expected the checkpoint to be kept: %v", err)
+	}
+	retry := reloaded.retryObjects()
+	if _, done := reloaded.startToken(); !done || len(reloaded.done) != 0 || len(retry) != 1 || aws.ToString(retry[0].Key) != "data/bad.txt" {
+		t.Errorf("Expected only the failed key to be left, got %v and %v", reloaded.done, retry)
+	}
+}
+
+// Test a failed key does not hold the checkpoint back, and is retried first on resume
+func TestOverwritePrefix_CheckpointPastFailure(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.checkpoint")
+	client := newMockClient(mockObject{body: "test content"})
+	client.keys = numberedKeys("data/", 100)
+	client.getObjectErrors = map[string]error{"data/000.txt": errors.New("access denied")}
+
+	var order []string
+	ctx, cancel := context.WithCancel(context.Background())
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		order = append(order, info.Key)
+		if len(order) == 60 {
+			cancel()
+		}
+		return srcFilePath, false, nil
+	}
+	_, err := OverwritePrefix(ctx, client, "test-bucket", "data/", callback,
+		WithCannedACL("private"), WithWorkers(1), WithCheckpoint(path))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var saved checkpointFile
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if saved.ContinuationToken != "60" || len(saved.Completed) != 1 || len(saved.Failed) != 1 || saved.Failed[0].Key != "data/000.txt" {
+		t.Errorf("Expected the checkpoint to move past the failed key, got %+v", saved)
+	}
+
+	delete(client.getObjectErrors, "data/000.txt")
+	order = nil
+	summary, err := OverwritePrefix(context.Background(), client, "test-bucket", "data/", callback,
+		WithCannedACL("private"), WithWorkers(1), WithCheckpoint(path))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The failed key, then 061 to 099
+	if len(order) != 40 || order[0] != "data/000.txt" || summary.Written != 40 || summary.Resumed != 1 {
+		t.Errorf("Expected the failed key first and then the unfinished keys, got %v: %+v", order, summary)
+	}
+}
+
+// Test checkpoints are tied to the bucket and prefix
+func TestOverwritePrefix_CheckpointMismatch(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.checkpoint")
+	if err := os.WriteFile(path, []byte(`{"bucket":"other","prefix":"data/"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := OverwritePrefix(context.Background(), newMockClient(mockObject{}), "test-bucket", "data/", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return "", false, nil
+	}, WithCheckpoint(path))
+	if err == nil {
+		t.Fatal("Expected an error for a checkpoint of another bucket")
+	}
+}
+
+// Test dry runs cannot be checkpointed, since planned objects are not written
+func TestOverwritePrefix_CheckpointDryRun(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.checkpoint")
+	client := newMockClient(mockObject{})
+	client.keys = numberedKeys("data/", 3)
+
+	summary, err := OverwritePrefix(context.Background(), client, "test-bucket", "data/", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCheckpoint(path), WithDryRun(nil))
+	if err == nil {
+		t.Fatal("Expected an error for a checkpointed dry run")
+	}
+	if summary.Processed != 0 {
+		t.Errorf("Expected nothing processed, got %d", summary.Processed)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected no checkpoint file, got %v", err)
+	}
+}
+
+// Test finished pages are dropped and the token advances
+func TestCheckpointer_Advance(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "batch.checkpoint")
+	c, err := loadCheckpoint(path, "bucket", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page := func(keys ...string) []types.Object {
+		var objects []types.Object
+		for _, key := range keys {
+			objects = append(objects, types.Object{Key: aws.String(key)})
+		}
+		return objects
+	}
+
+	c.addPage("", "t1", false, page("a", "b"))
+	c.addPage("t1", "", true, page("c"))
+	c.begin("b")
+	c.finish("b")
+	c.begin("c")
+	c.finish("c")
+	c.flush()
+
+	reloaded, err := loadCheckpoint(path, "bucket", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token, done := reloaded.startToken(); token != "" || done || !reloaded.done["b"] || !reloaded.done["c"] {
+		t.Errorf("Unexpected checkpoint token %q, done %v, keys %v", token, done, reloaded.done)
+	}
+
+	c.finish("a")
+	c.flush()
+	reloaded, _ = loadCheckpoint(path, "bucket", "")
+	if _, done := reloaded.startToken(); !done || len(reloaded.done) != 0 {
+		t.Error("Expected a completed listing with no pending pages")
+	}
+}
@@ -0,0 +1,159 @@
+package overwrite
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrIntegrityCheckFailed is returned (wrapped) when a downloaded body is shorter or
+// longer than its Content-Length, or does not match the object's checksum
+var ErrIntegrityCheckFailed = errors.New("integrity check failed")
+
+// objectChecksum is the checksum S3 reports for an object when ChecksumMode is enabled
+type objectChecksum struct {
+	algorithm types.ChecksumAlgorithm // empty if the object has none
+	value     string                  // base64-encoded
+}
+
+// full reports whether the checksum covers the whole body. Objects uploaded in parts
+// carry a checksum of the part checksums, suffixed with the part count.
+func (c objectChecksum) full() bool {
+	return c.algorithm != "" && !strings.Contains(c.value, "-")
+}
+
+// checksumFromGetObject returns the checksum in a GetObject response
+func checksumFromGetObject(getResp *s3.GetObjectOutput) objectChecksum {
+	switch {
+	case getResp.ChecksumSHA256 != nil:
+		return objectChecksum{types.ChecksumAlgorithmSha256, *getResp.ChecksumSHA256}
+	case getResp.ChecksumCRC32C != nil:
+		return objectChecksum{types.ChecksumAlgorithmCrc32c, *getResp.ChecksumCRC32C}
+	case getResp.ChecksumCRC32 != nil:
+		return objectChecksum{types.ChecksumAlgorithmCrc32, *getResp.ChecksumCRC32}
+	case getResp.ChecksumSHA1 != nil:
+		return objectChecksum{types.ChecksumAlgorithmSha1, *getResp.ChecksumSHA1}
+	}
+	return objectChecksum{}
+}
+
+// newChecksumHash returns the hash computing algorithm, or nil if it is unknown
+func newChecksumHash(algorithm types.ChecksumAlgorithm) hash.Hash {
+	switch algorithm {
+	case types.ChecksumAlgorithmSha256:
+		return sha256.New()
+	case types.ChecksumAlgorithmCrc32c:
+		return crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	case types.ChecksumAlgorithmCrc32:
+		return crc32.NewIEEE()
+	case types.ChecksumAlgorithmSha1:
+		return sha1.New()
+	}
+	return nil
+}
+
+// verifiedBody reads an object's body and, at EOF, checks it against the Content-Length
+// and the full-object checksum of the response. A mismatch is returned instead of io.EOF.
+type verifiedBody struct {
+	r      io.Reader
+	length *int64
+	want   objectChecksum
+	h      hash.Hash // nil without a full-object checksum
+	n      int64
+}
+
+// newVerifiedBody returns a verifiedBody for the body of getResp
+func newVerifiedBody(getResp *s3.GetObjectOutput) *verifiedBody {
+	b := &verifiedBody{r: getResp.Body, length: getResp.ContentLength, want: checksumFromGetObject(getResp)}
+	if b.want.full() {
+		b.h = newChecksumHash(b.want.algorithm)
+	}
+	return b
+}
+
+func (b *verifiedBody) Read(p []byte) (int, error) {
+	n, err := b.r.Read(p)
+	b.n += int64(n)
+	if b.h != nil {
+		b.h.Write(p[:n])
+	}
+	if err == io.EOF {
+		if verr := b.verify(); verr != nil {
+			return n, verr
+		}
+	}
+	return n, err
+}
+
+// verify compares what was read with the expected length and checksum
+func (b *verifiedBody) verify() error {
+	if b.length != nil && b.n != *b.length {
+		return fmt.Errorf("%w: read %d of %d bytes: %w", ErrIntegrityCheckFailed, b.n, *b.length, io.ErrUnexpectedEOF)
+	}
+	if b.h != nil {
+		if got := base64.StdEncoding.EncodeToString(b.h.Sum(nil)); got != b.want.value {
+			return fmt.Errorf("%w: %s is %s, expected %s", ErrIntegrityCheckFailed, b.want.algorithm, got, b.want.value)
+		}
+	}
+	return nil
+}
+
+// addChecksumToPut computes the checksum of body with the algorithm of putInput and
+// sets it, so that S3 rejects a body corrupted on the way. body is read from the start
+// and left there; a checksum that is already set is kept.
+func addChecksumToPut(putInput *s3.PutObjectInput, body io.ReadSeeker) error {
+	h := newChecksumHash(putInput.ChecksumAlgorithm)
+	if h == nil || checksumOfPut(putInput) != nil {
+		return nil
+	}
+	if _, err := io.Copy(h, body); err != nil {
+		return fmt.Errorf("failed to compute checksum: %w", err)
+	}
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to compute checksum: %w", err)
+	}
+	value := aws.String(base64.StdEncoding.EncodeToString(h.Sum(nil)))
+	switch putInput.ChecksumAlgorithm {
+	case types.ChecksumAlgorithmSha256:
+		putInput.ChecksumSHA256 = value
+	case types.ChecksumAlgorithmCrc32c:
+		putInput.ChecksumCRC32C = value
+	case types.ChecksumAlgorithmCrc32:
+		putInput.ChecksumCRC32 = value
+	case types.ChecksumAlgorithmSha1:
+		putInput.ChecksumSHA1 = value
+	}
+	return nil
+}
+
+// checksumOfPut returns the checksum set in putInput, if any
+func checksumOfPut(putInput *s3.PutObjectInput) *string {
+	switch {
+	case putInput.ChecksumSHA256 != nil:
+		return putInput.ChecksumSHA256
+	case putInput.ChecksumCRC32C != nil:
+		return putInput.ChecksumCRC32C
+	case putInput.ChecksumCRC32 != nil:
+		return putInput.ChecksumCRC32
+	}
+	return putInput.ChecksumSHA1
+}
+
+// uploadChecksumAlgorithm returns the algorithm of the original object's checksum, so
+// the new object keeps it, or SHA-256 if it has none
+func uploadChecksumAlgorithm(c objectChecksum) types.ChecksumAlgorithm {
+	if c.algorithm != "" {
+		return c.algorithm
+	}
+	return types.ChecksumAlgorithmSha256
+}
@@ -0,0 +1,169 @@
+package overwrite
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"hash/crc32"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+func sha256Base64(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+func crc32cBase64(s string) string {
+	h := crc32.New(crc32.MakeTable(crc32.Castagnoli))
+	h.Write([]byte(s))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// Test downloaded bodies are checked against their length and checksum
+func TestVerifiedBody(t *testing.T) {
+	tests := []struct {
+		name    string
+		resp    *s3.GetObjectOutput
+		wantErr bool
+	}{
+		{"no checksum", &s3.GetObjectOutput{ContentLength: aws.Int64(11)}, false},
+		{"truncated", &s3.GetObjectOutput{ContentLength: aws.Int64(20)}, true},
+		{"SHA256", &s3.GetObjectOutput{ChecksumSHA256: aws.String(sha256Base64("hello world"))}, false},
+		{"CRC32C", &s3.GetObjectOutput{ChecksumCRC32C: aws.String(crc32cBase64("hello world"))}, false},
+		{"corrupted", &s3.GetObjectOutput{ChecksumSHA256: aws.String(sha256Base64("hello there"))}, true},
+		{"composite", &s3.GetObjectOutput{ChecksumCRC32C: aws.String("AAAAAA==-2")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.resp.Body = io.NopCloser(strings.NewReader("hello world"))
+			_, err := io.Copy(io.Discard, newVerifiedBody(tt.resp))
+			if tt.wantErr != errors.Is(err, ErrIntegrityCheckFailed) {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+// Test a truncated download is never passed to the callback
+func TestOverwrite_TruncatedDownload(t *testing.T) {
+	client := newMockClient(retryObject)
+	gets := 0
+	client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+		if input.ChecksumMode != types.ChecksumModeEnabled {
+			t.Errorf("Expected ChecksumMode to be enabled")
+		}
+		gets++
+		body := "hello world"
+		if gets == 1 {
+			body = "hello"
+		}
+		return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader(body)), ContentLength: aws.Int64(11), ETag: aws.String(`"etag"`)}, nil
+	}
+	client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+		return &s3.PutObjectOutput{}, nil
+	}
+	calls := 0
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		calls++
+		return srcFilePath, false, nil
+	}
+
+	_, err := Overwrite(context.Background(), client, "test-bucket", "key", callback)
+	var oe *OverwriteError
+	if !errors.Is(err, ErrIntegrityCheckFailed) || !errors.As(err, &oe) || oe.Stage != StageDownload || calls != 0 {
+		t.Fatalf("Expected an integrity error before the callback, got %v", err)
+	}
+
+	// A retry downloads it again
+	gets = 0
+	result, err := Overwrite(context.Background(), client, "test-bucket", "key", callback,
+		WithRetryPolicy(RetryPolicy{MaxAttempts: 2, BaseDelay: time.Millisecond}, StageDownload))
+	if err != nil || result.BytesDownloaded != 11 || calls != 1 {
+		t.Errorf("Expected the retry to succeed, got %d bytes: %v", result.BytesDownloaded, err)
+	}
+}
+
+// Test the upload carries a checksum with the original object's algorithm
+func TestOverwrite_UploadChecksum(t *testing.T) {
+	tests := []struct {
+		name      string
+		original  *s3.GetObjectOutput
+		algorithm types.ChecksumAlgorithm
+		checksum  func(input *s3.PutObjectInput) *string
+		want      string
+	}{
+		{
+			name:      "no checksum",
+			original:  &s3.GetObjectOutput{},
+			algorithm: types.ChecksumAlgorithmSha256,
+			checksum:  func(input *s3.PutObjectInput) *string { return input.ChecksumSHA256 },
+			want:      sha256Base64("HELLO WORLD"),
+		},
+		{
+			name:      "CRC32C",
+			original:  &s3.GetObjectOutput{ChecksumCRC32C: aws.String(crc32cBase64("hello world"))},
+			algorithm: types.ChecksumAlgorithmCrc32c,
+			checksum:  func(input *s3.PutObjectInput) *string { return input.ChecksumCRC32C },
+			want:      crc32cBase64("HELLO WORLD"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newMockClient(retryObject)
+			client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+				resp := *tt.original
+				resp.Body = io.NopCloser(strings.NewReader("hello world"))
+				return &resp, nil
+			}
+			var putInput *s3.PutObjectInput
+			client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+				putInput = input
+				body, _ := io.ReadAll(input.Body)
+				if string(body) != "HELLO WORLD" {
+					t.Errorf("Expected the whole body, got %q", body)
+				}
+				return &s3.PutObjectOutput{}, nil
+			}
+			callback := func(info ObjectInfo, src io.Reader, dst io.Writer) error {
+				data, err := io.ReadAll(src)
+				if err != nil {
+					return err
+				}
+				_, err = dst.Write([]byte(strings.ToUpper(string(data))))
+				return err
+			}
+			fileCallback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+				outPath := srcFilePath + ".out"
+				return outPath, true, os.WriteFile(outPath, []byte("HELLO WORLD"), 0644)
+			}
+			run := map[string]func() error{
+				"Overwrite": func() error {
+					_, err := Overwrite(context.Background(), client, "test-bucket", "key", fileCallback)
+					return err
+				},
+				"OverwriteStream": func() error {
+					_, err := OverwriteStream(context.Background(), client, "test-bucket", "key", callback)
+					return err
+				},
+			}
+			for name, overwrite := range run {
+				putInput = nil
+				if err := overwrite(); err != nil {
+					t.Fatalf("%s: unexpected error: %v", name, err)
+				}
+				if putInput.ChecksumAlgorithm != tt.algorithm || aws.ToString(tt.checksum(putInput)) != tt.want {
+					t.Errorf("%s: expected %s %s, got %s %s", name, tt.algorithm, tt.want, putInput.ChecksumAlgorithm, aws.ToString(tt.checksum(putInput)))
+				}
+			}
+		})
+	}
+}
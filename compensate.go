@@ -0,0 +1,102 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ACLFailurePolicy decides what happens when PutObjectAcl still fails to restore WRITE
+// grants after its retries, leaving the new object with a narrower ACL than intended
+type ACLFailurePolicy int
+
+const (
+	// ACLFailureReport returns the error and leaves the object as it is (the default)
+	ACLFailureReport ACLFailurePolicy = iota
+	// ACLFailureReapply applies the intended ACL, including its WRITE grants and the
+	// original owner, in a single PutObjectAcl with an AccessControlPolicy body
+	ACLFailureReapply
+	// ACLFailureRollback copies the previous version back over the object, with its
+	// attributes. It requires a versioned bucket and a client implementing CopyClient.
+	ACLFailureRollback
+)
+
+// ACLCompensation reports what was done after PutObjectAcl failed (see WithACLFailurePolicy)
+type ACLCompensation string
+
+const (
+	// ACLCompensationReapplied means the intended ACL was re-applied
+	ACLCompensationReapplied ACLCompensation = "reapplied"
+	// ACLCompensationRolledBack means the previous version was copied back
+	ACLCompensationRolledBack ACLCompensation = "rolled-back"
+	// ACLCompensationFailed means the compensation failed too
+	ACLCompensationFailed ACLCompensation = "failed"
+)
+
+// clone returns a copy of the ACL whose grants the callback cannot change
+func (a *ObjectACL) clone() *ObjectACL {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	c.Grants = append([]Grant(nil), a.Grants...)
+	return &c
+}
+
+// finishACL restores WRITE grants after the object was written and, if that fails,
+// compensates according to the ACL failure policy. The PutObjectAcl error is always
+// returned; result.ACLCompensation reports the compensation.
+func finishACL(ctx context.Context, client S3Client, bucket, key string, src *source, grants []types.Grant, o *options, result *OverwriteResult) error {
+	err := restoreWriteGrants(ctx, client, bucket, key, grants, o, result)
+	if err == nil || o.aclFailure == ACLFailureReport {
+		return err
+	}
+
+	var compErr error
+	switch o.aclFailure {
+	case ACLFailureReapply:
+		compErr = reapplyACL(ctx, client, bucket, key, grants, src.acl)
+		result.ACLCompensation = ACLCompensationReapplied
+	case ACLFailureRollback:
+		compErr = rollbackVersion(ctx, client, bucket, key, result.OldVersionId, o)
+		result.ACLCompensation = ACLCompensationRolledBack
+	}
+	if compErr != nil {
+		result.ACLCompensation = ACLCompensationFailed
+		return errors.Join(err, stageError(StagePutACL, fmt.Errorf("compensation failed: %w", compErr)))
+	}
+	return stageError(StagePutACL, fmt.Errorf("%w (compensated: %s)", err, result.ACLCompensation))
+}
+
+// reapplyACL replaces the object's ACL with grants, keeping the owner of the
+// original acl
+func reapplyACL(ctx context.Context, client S3Client, bucket, key string, grants []types.Grant, acl *ObjectACL) error {
+	policy := &types.AccessControlPolicy{Grants: grants}
+	if acl != nil && acl.Owner.ID != "" {
+		policy.Owner = &types.Owner{ID: aws.String(acl.Owner.ID)}
+	}
+	_, err := client.PutObjectAcl(ctx, &s3.PutObjectAclInput{
+		Bucket:              aws.String(bucket),
+		Key:                 aws.String(key),
+		AccessControlPolicy: policy,
+	})
+	return err
+}
+
+// rollbackVersion copies version versionID back over the object with its attributes
+func rollbackVersion(ctx context.Context, client S3Client, bucket, key string, versionID *string, o *options) error {
+	cc, ok := client.(CopyClient)
+	if !ok {
+		return errors.New("the client does not implement CopyClient")
+	}
+	if v := aws.ToString(versionID); v == "" || v == "null" {
+		return ErrNoPreviousVersion
+	}
+	ro := *o
+	ro.aclFailure = ACLFailureReport
+	return restore(ctx, cc, bucket, key, versionID, bucket, key, &ro, &OverwriteResult{})
+}
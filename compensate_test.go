@@ -0,0 +1,125 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test restoring WRITE grants is retried, and compensated when it keeps failing
+func TestOverwrite_ACLFailure(t *testing.T) {
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		info.ACL.Grants = append(info.ACL.Grants, Grant{ID: "partner", Permission: types.PermissionRead})
+		return srcFilePath, false, nil
+	}
+
+	// A versioned object with a WRITE grant, whose PutObjectAcl calls with grant headers
+	// fail failures times
+	object := taggedObject()
+	object.versionID = "v1"
+	object.owner = "owner"
+	object.grants = []types.Grant{
+		{Grantee: &types.Grantee{URI: aws.String(AllUsersURI)}, Permission: types.PermissionWrite},
+	}
+	newClient := func(object mockObject, failures int) *mockS3Client {
+		client := newMockClient(object)
+		client.putObjectAclFunc = func(ctx context.Context, input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+			if input.AccessControlPolicy == nil && len(client.aclInputs) <= failures {
+				return nil, errors.New("service unavailable")
+			}
+			return &s3.PutObjectAclOutput{}, nil
+		}
+		return client
+	}
+
+	t.Run("retried", func(t *testing.T) {
+		client := newClient(object, 2)
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", callback, WithACLRetries(2))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(client.aclInputs) != 3 || !result.ACLRestored || result.ACLCompensation != "" {
+			t.Errorf("Expected success on the third attempt, got %d attempts and %+v", len(client.aclInputs), result)
+		}
+	})
+
+	t.Run("reported", func(t *testing.T) {
+		client := newClient(object, 10)
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", callback, WithACLRetries(1))
+		var oe *OverwriteError
+		if !errors.As(err, &oe) || oe.Stage != StagePutACL || !oe.Written {
+			t.Fatalf("Expected a PutACL error after the write, got %v", err)
+		}
+		if len(client.aclInputs) != 2 || result.ACLCompensation != "" {
+			t.Errorf("Unexpected attempts %d or compensation %q", len(client.aclInputs), result.ACLCompensation)
+		}
+	})
+
+	t.Run("reapply", func(t *testing.T) {
+		// A public object whose callback revokes AllUsers READ and adds a partner
+		public := object
+		public.grants = append([]types.Grant{
+			{Grantee: &types.Grantee{URI: aws.String(AllUsersURI)}, Permission: types.PermissionRead},
+		}, object.grants...)
+		client := newClient(public, 10)
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			info.ACL.Grants = slices.DeleteFunc(info.ACL.Grants, func(g Grant) bool {
+				return g.URI == AllUsersURI && g.Permission == types.PermissionRead
+			})
+			return callback(info, srcFilePath)
+		}, WithACLFailurePolicy(ACLFailureReapply))
+		if err == nil {
+			t.Fatal("Expected the PutObjectAcl error")
+		}
+		if result.ACLCompensation != ACLCompensationReapplied {
+			t.Fatalf("Unexpected compensation %q", result.ACLCompensation)
+		}
+		policy := client.aclInputs[len(client.aclInputs)-1].AccessControlPolicy
+		if policy == nil || aws.ToString(policy.Owner.ID) != "owner" || len(policy.Grants) != 2 {
+			t.Fatalf("Expected the intended ACL, got %+v", policy)
+		}
+		for _, g := range policy.Grants {
+			if aws.ToString(g.Grantee.URI) == AllUsersURI && g.Permission == types.PermissionRead {
+				t.Error("The revoked AllUsers READ grant must stay revoked")
+			}
+		}
+		if policy.Grants[0].Permission != types.PermissionWrite || aws.ToString(policy.Grants[1].Grantee.ID) != "partner" {
+			t.Errorf("Expected the WRITE grant and the partner's grant, got %+v", policy.Grants)
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		client := newClient(object, 10)
+		client.putObjectAclFunc = func(ctx context.Context, input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+			if len(client.aclInputs) == 1 {
+				return nil, errors.New("service unavailable")
+			}
+			return &s3.PutObjectAclOutput{}, nil
+		}
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", callback, WithACLFailurePolicy(ACLFailureRollback))
+		if err == nil {
+			t.Fatal("Expected the PutObjectAcl error")
+		}
+		if result.ACLCompensation != ACLCompensationRolledBack {
+			t.Fatalf("Unexpected compensation %q: %v", result.ACLCompensation, err)
+		}
+		if len(client.copyInputs) != 1 || aws.ToString(client.copyInputs[0].CopySource) != "test-bucket/key?versionId=v1" {
+			t.Errorf("Expected v1 to be copied back, got %+v", client.copyInputs)
+		}
+	})
+
+	t.Run("rollback without versions", func(t *testing.T) {
+		unversioned := object
+		unversioned.versionID = ""
+		client := newClient(unversioned, 10)
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", callback, WithACLFailurePolicy(ACLFailureRollback))
+		if !errors.Is(err, ErrNoPreviousVersion) || result.ACLCompensation != ACLCompensationFailed {
+			t.Errorf("Expected a failed compensation, got %q: %v", result.ACLCompensation, err)
+		}
+	})
+}
@@ -0,0 +1,382 @@
+package overwrite
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// CopyClient is the interface required by OverwriteMetadata.
+// *s3.Client implements it.
+type CopyClient interface {
+	S3Client
+	HeadClient
+	CopyObject(ctx context.Context, params *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error)
+}
+
+// MultipartCopyClient is the optional interface for copying objects larger than 5 GiB.
+// *s3.Client implements it.
+type MultipartCopyClient interface {
+	MultipartClient
+	UploadPartCopy(ctx context.Context, params *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error)
+}
+
+// MetadataCallback defines the metadata-only callback function signature
+// The callback edits info.Metadata, info.Headers, info.Tags and info.ACL.
+// Returning false leaves the object unchanged.
+type MetadataCallback func(info ObjectInfo) (changed bool, err error)
+
+// OverwriteMetadata changes an object's metadata, headers, tags and ACL without
+// downloading it. ObjectInfo comes from HeadObject, and the changes are applied by
+// copying the object onto itself. Objects larger than 5 GiB are copied in parts,
+// which requires MultipartCopyClient.
+func OverwriteMetadata(
+	ctx context.Context,
+	client CopyClient,
+	bucket string,
+	key string,
+	callback MetadataCallback,
+	opts ...Option,
+) (*OverwriteResult, error) {
+	o := newOptions(opts)
+	return retryOnConcurrentModification(bucket, key, o, func(result *OverwriteResult) error {
+		return overwriteMetadata(ctx, client, bucket, key, callback, o, result)
+	})
+}
+
+// overwriteMetadata performs a single metadata-only overwrite attempt
+func overwriteMetadata(
+	ctx context.Context,
+	client CopyClient,
+	bucket string,
+	key string,
+	callback MetadataCallback,
+	o *options,
+	result *OverwriteResult,
+) error {
+	// Read the object's attributes
+	headStart := time.Now()
+	src, err := headSource(ctx, client, bucket, key, nil, o, result)
+	if err != nil {
+		return err
+	}
+	result.Timings.Download = time.Since(headStart)
+
+	if o.decides() {
+		if skip, err := runDecide(newDecideInfo(bucket, key, src.getResp), o, result); skip || err != nil {
+			return err
+		}
+	}
+	if skip, err := checkObjectLock(src, o, result); skip || err != nil {
+		return err
+	}
+
+	// HeadObject does not report tags, so always fetch them
+	attributesStart := time.Now()
+	tags, err := fetchTags(ctx, client, bucket, key, nil, o)
+	if err != nil {
+		return err
+	}
+	src.getResp.TagCount = aws.Int32(int32(len(tags)))
+	acl, err := getACL(ctx, client, bucket, key, nil, o)
+	if err != nil {
+		return err
+	}
+	src.acl = acl.clone()
+	result.Timings.Attributes = time.Since(attributesStart)
+
+	info := newObjectInfo(bucket, key, src.getResp, tags, acl)
+
+	callbackStart := time.Now()
+	changed, err := callback(info)
+	result.Timings.Callback = time.Since(callbackStart)
+	if err != nil {
+		return stageError(StageCallback, fmt.Errorf("callback error: %w", err))
+	}
+	if !changed {
+		result.Status = StatusSkipped
+		return nil
+	}
+
+	// The body is copied as it is, so only the attributes can change
+	size := aws.ToInt64(src.getResp.ContentLength)
+	return writeObject(ctx, client, bucket, key, src, info, tags, callbackOutput{
+		unchanged: func() (bool, error) {
+			return true, nil
+		},
+		plan: func(plan *PlanEntry) (bool, error) {
+			plan.OldSize, plan.NewSize = size, size
+			return false, nil
+		},
+		write: func(putInput *s3.PutObjectInput) (bool, error) {
+			from := copyFrom{
+				source:  copySourceFor(bucket, key, src.getResp.VersionId),
+				ifMatch: putInput.IfMatch,
+				size:    size,
+			}
+			if err := copyObject(ctx, client, putInput, from, o, result); err != nil {
+				return false, copyObjectError(err, o)
+			}
+			return false, nil
+		},
+	}, o, result)
+}
+
+// headSource calls HeadObject, sending the SSE-C key if one is configured, and
+// presents the response as a bodiless GetObject response
+func headSource(ctx context.Context, client HeadClient, bucket, key string, versionID *string, o *options, result *OverwriteResult) (*source, error) {
+	customerKey, err := lookupCustomerKey(bucket, key, o)
+	if err != nil {
+		return nil, stageError(StageDownload, err)
+	}
+
+	headInput := &s3.HeadObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		VersionId:    versionID,
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	addEncryptionToInput(headInput, encryption{customerKey: customerKey})
+	var headResp *s3.HeadObjectOutput
+	err = retryStage(ctx, o, StageDownload, func(int) error {
+		var err error
+		headResp, err = client.HeadObject(ctx, headInput)
+		return err
+	})
+	if err != nil {
+		return nil, stageError(StageDownload, fmt.Errorf("failed to head object: %w", err))
+	}
+	result.OldETag = headResp.ETag
+	result.OldVersionId = headResp.VersionId
+
+	getResp := getOutputFromHead(headResp)
+	return &source{
+		getResp:     getResp,
+		customerKey: customerKey,
+		lock:        objectLockFromGetObject(getResp),
+	}, nil
+}
+
+// getOutputFromHead copies the attributes of a HeadObject response into a GetObject
+// response with an empty body
+func getOutputFromHead(h *s3.HeadObjectOutput) *s3.GetObjectOutput {
+	return &s3.GetObjectOutput{
+		Body:                      http.NoBody,
+		BucketKeyEnabled:          h.BucketKeyEnabled,
+		CacheControl:              h.CacheControl,
+		ChecksumCRC32:             h.ChecksumCRC32,
+		ChecksumCRC32C:            h.ChecksumCRC32C,
+		ChecksumSHA1:              h.ChecksumSHA1,
+		ChecksumSHA256:            h.ChecksumSHA256,
+		ContentDisposition:        h.ContentDisposition,
+		ContentEncoding:           h.ContentEncoding,
+		ContentLanguage:           h.ContentLanguage,
+		ContentLength:             h.ContentLength,
+		ContentType:               h.ContentType,
+		ETag:                      h.ETag,
+		ExpiresString:             h.ExpiresString,
+		LastModified:              h.LastModified,
+		Metadata:                  h.Metadata,
+		ObjectLockLegalHoldStatus: h.ObjectLockLegalHoldStatus,
+		ObjectLockMode:            h.ObjectLockMode,
+		ObjectLockRetainUntilDate: h.ObjectLockRetainUntilDate,
+		SSECustomerAlgorithm:      h.SSECustomerAlgorithm,
+		SSECustomerKeyMD5:         h.SSECustomerKeyMD5,
+		SSEKMSKeyId:               h.SSEKMSKeyId,
+		ServerSideEncryption:      h.ServerSideEncryption,
+		StorageClass:              h.StorageClass,
+		VersionId:                 h.VersionId,
+		WebsiteRedirectLocation:   h.WebsiteRedirectLocation,
+	}
+}
+
+// copyFrom is the object version a copy reads
+type copyFrom struct {
+	source  string  // URL-encoded CopySource
+	ifMatch *string // CopySourceIfMatch
+	size    int64
+}
+
+// copySourceFor builds the URL-encoded CopySource for an object version
+func copySourceFor(bucket, key string, versionID *string) string {
+	source := (&url.URL{Path: bucket + "/" + key}).EscapedPath()
+	// S3 may decode a literal "+" as a space
+	source = strings.ReplaceAll(source, "+", "%2B")
+	if versionID != nil {
+		source += "?versionId=" + url.QueryEscape(*versionID)
+	}
+	return source
+}
+
+// copyInputFromPut builds CopyObject input that replaces the object's attributes with
+// those of the equivalent PutObject input
+func copyInputFromPut(putInput *s3.PutObjectInput, from copyFrom) *s3.CopyObjectInput {
+	return &s3.CopyObjectInput{
+		Bucket:                         putInput.Bucket,
+		Key:                            putInput.Key,
+		CopySource:                     aws.String(from.source),
+		CopySourceIfMatch:              from.ifMatch,
+		CopySourceSSECustomerAlgorithm: putInput.SSECustomerAlgorithm,
+		CopySourceSSECustomerKey:       putInput.SSECustomerKey,
+		CopySourceSSECustomerKeyMD5:    putInput.SSECustomerKeyMD5,
+		MetadataDirective:              types.MetadataDirectiveReplace,
+		TaggingDirective:               types.TaggingDirectiveReplace,
+		ACL:                            putInput.ACL,
+		BucketKeyEnabled:               putInput.BucketKeyEnabled,
+		CacheControl:                   putInput.CacheControl,
+		ChecksumAlgorithm:              putInput.ChecksumAlgorithm,
+		ContentDisposition:             putInput.ContentDisposition,
+		ContentEncoding:                putInput.ContentEncoding,
+		ContentLanguage:                putInput.ContentLanguage,
+		ContentType:                    putInput.ContentType,
+		Expires:                        putInput.Expires,
+		GrantFullControl:               putInput.GrantFullControl,
+		GrantRead:                      putInput.GrantRead,
+		GrantReadACP:                   putInput.GrantReadACP,
+		GrantWriteACP:                  putInput.GrantWriteACP,
+		Metadata:                       putInput.Metadata,
+		ObjectLockLegalHoldStatus:      putInput.ObjectLockLegalHoldStatus,
+		ObjectLockMode:                 putInput.ObjectLockMode,
+		ObjectLockRetainUntilDate:      putInput.ObjectLockRetainUntilDate,
+		SSECustomerAlgorithm:           putInput.SSECustomerAlgorithm,
+		SSECustomerKey:                 putInput.SSECustomerKey,
+		SSECustomerKeyMD5:              putInput.SSECustomerKeyMD5,
+		SSEKMSEncryptionContext:        putInput.SSEKMSEncryptionContext,
+		SSEKMSKeyId:                    putInput.SSEKMSKeyId,
+		ServerSideEncryption:           putInput.ServerSideEncryption,
+		StorageClass:                   putInput.StorageClass,
+		Tagging:                        putInput.Tagging,
+		WebsiteRedirectLocation:        putInput.WebsiteRedirectLocation,
+	}
+}
+
+// copyObject copies from to the destination in putInput with the attributes in
+// putInput, in parts if it is too large for CopyObject
+func copyObject(
+	ctx context.Context,
+	client CopyClient,
+	putInput *s3.PutObjectInput,
+	from copyFrom,
+	o *options,
+	result *OverwriteResult,
+) error {
+	if from.size > maxPutObjectSize {
+		mc, ok := client.(MultipartCopyClient)
+		if !ok {
+			return fmt.Errorf("object is %d bytes, larger than CopyObject allows, and the client does not support UploadPartCopy", from.size)
+		}
+		var completeResp *s3.CompleteMultipartUploadOutput
+		err := retryStage(ctx, o, StagePut, func(int) error {
+			var err error
+			completeResp, err = uploadMultipart(ctx, mc, putInput, copyParts(mc, putInput, from, o))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		result.NewETag = completeResp.ETag
+		result.NewVersionId = completeResp.VersionId
+		return nil
+	}
+
+	var copyResp *s3.CopyObjectOutput
+	err := retryStage(ctx, o, StagePut, func(int) error {
+		var err error
+		copyResp, err = client.CopyObject(ctx, copyInputFromPut(putInput, from))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if copyResp.CopyObjectResult != nil {
+		result.NewETag = copyResp.CopyObjectResult.ETag
+	}
+	result.NewVersionId = copyResp.VersionId
+	return nil
+}
+
+// copyParts returns a partUploader that copies from in parts
+func copyParts(client MultipartCopyClient, putInput *s3.PutObjectInput, from copyFrom, o *options) partUploader {
+	return func(ctx context.Context, uploadID *string) ([]types.CompletedPart, error) {
+		size := from.size
+		partSize := partSizeFor(size, o.partSize)
+		partCount := max(int((size+partSize-1)/partSize), 1)
+
+		g := newPartGroup(ctx, o.multipartConcurrency)
+		for i := 1; i <= partCount; i++ {
+			partNumber := int32(i)
+			first := int64(i-1) * partSize
+			last := min(first+partSize, size) - 1
+			started := g.Go(func(ctx context.Context) (types.CompletedPart, error) {
+				return uploadPartCopy(ctx, client, putInput, from, uploadID, partNumber, first, last, o.partRetryPolicy())
+			})
+			if !started {
+				break
+			}
+		}
+		return g.Wait()
+	}
+}
+
+// uploadPartCopy copies the byte range first-last as a single part, retrying it
+// under policy
+func uploadPartCopy(
+	ctx context.Context,
+	client MultipartCopyClient,
+	putInput *s3.PutObjectInput,
+	from copyFrom,
+	uploadID *string,
+	partNumber int32,
+	first, last int64,
+	policy RetryPolicy,
+) (types.CompletedPart, error) {
+	part := types.CompletedPart{PartNumber: aws.Int32(partNumber)}
+	err := retryWith(ctx, policy, func(int) error {
+		partResp, err := client.UploadPartCopy(ctx, &s3.UploadPartCopyInput{
+			Bucket:                         putInput.Bucket,
+			Key:                            putInput.Key,
+			UploadId:                       uploadID,
+			PartNumber:                     aws.Int32(partNumber),
+			CopySource:                     aws.String(from.source),
+			CopySourceRange:                aws.String(fmt.Sprintf("bytes=%d-%d", first, last)),
+			CopySourceIfMatch:              from.ifMatch,
+			CopySourceSSECustomerAlgorithm: putInput.SSECustomerAlgorithm,
+			CopySourceSSECustomerKey:       putInput.SSECustomerKey,
+			CopySourceSSECustomerKeyMD5:    putInput.SSECustomerKeyMD5,
+			SSECustomerAlgorithm:           putInput.SSECustomerAlgorithm,
+			SSECustomerKey:                 putInput.SSECustomerKey,
+			SSECustomerKeyMD5:              putInput.SSECustomerKeyMD5,
+		})
+		if err != nil {
+			return err
+		}
+		if r := partResp.CopyPartResult; r != nil {
+			part.ETag = r.ETag
+			part.ChecksumCRC32 = r.ChecksumCRC32
+			part.ChecksumCRC32C = r.ChecksumCRC32C
+			part.ChecksumSHA1 = r.ChecksumSHA1
+			part.ChecksumSHA256 = r.ChecksumSHA256
+		}
+		return nil
+	})
+	if err != nil {
+		return types.CompletedPart{}, fmt.Errorf("failed to copy part %d: %w", partNumber, err)
+	}
+	return part, nil
+}
+
+// copyObjectError wraps a copy failure, marking failed preconditions as concurrent
+// modifications when conditional writes are enabled
+func copyObjectError(err error, o *options) error {
+	if o.conditionalWrite && IsPreconditionFailed(err) {
+		return stageError(StagePut, fmt.Errorf("failed to copy object: %w: %w", ErrConcurrentModification, err))
+	}
+	return stageError(StagePut, fmt.Errorf("failed to copy object: %w", err))
+}
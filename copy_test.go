@@ -0,0 +1,151 @@
+package overwrite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test metadata-only changes are applied with CopyObject without downloading the body
+func TestOverwriteMetadata(t *testing.T) {
+	client := &mockS3Client{
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []types.Tag{{Key: aws.String("tag1"), Value: aws.String("value1")}},
+			}, nil
+		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{
+				Grants: []types.Grant{
+					{
+						Grantee:    &types.Grantee{Type: types.TypeCanonicalUser, ID: aws.String("123456")},
+						Permission: types.PermissionRead,
+					},
+				},
+			}, nil
+		},
+		headObjectFunc: func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ContentType:          aws.String("text/html"),
+				CacheControl:         aws.String("no-cache"),
+				ContentLength:        aws.Int64(100),
+				ETag:                 aws.String(`"old-etag"`),
+				VersionId:            aws.String("v1"),
+				Metadata:             map[string]string{"key1": "value1"},
+				StorageClass:         types.StorageClassStandardIa,
+				ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+				SSEKMSKeyId:          aws.String("kms-key"),
+			}, nil
+		},
+	}
+
+	result, err := OverwriteMetadata(context.Background(), client, "test-bucket", "dir/a b.html", func(info ObjectInfo) (bool, error) {
+		if aws.ToString(info.ContentType) != "text/html" || info.Tags["tag1"] != "value1" || aws.ToInt64(info.TagCount) != 1 {
+			t.Errorf("Unexpected info %+v", info)
+		}
+		info.Headers.CacheControl = aws.String("max-age=3600")
+		info.Metadata["key2"] = aws.String("value2")
+		info.Tags["processed"] = "v3"
+		return true, nil
+	}, WithConditionalWrite())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	in := client.copyInput
+	if aws.ToString(in.CopySource) != "test-bucket/dir/a%20b.html?versionId=v1" {
+		t.Errorf("Unexpected copy source %v", aws.ToString(in.CopySource))
+	}
+	if in.MetadataDirective != types.MetadataDirectiveReplace || in.TaggingDirective != types.TaggingDirectiveReplace {
+		t.Error("Expected REPLACE directives")
+	}
+	if aws.ToString(in.CacheControl) != "max-age=3600" || aws.ToString(in.ContentType) != "text/html" {
+		t.Errorf("Headers not applied: %v, %v", in.CacheControl, in.ContentType)
+	}
+	if in.Metadata["key1"] != "value1" || in.Metadata["key2"] != "value2" {
+		t.Errorf("Metadata not applied, got %v", in.Metadata)
+	}
+	if aws.ToString(in.Tagging) != "processed=v3&tag1=value1" {
+		t.Errorf("Tags not applied, got %v", aws.ToString(in.Tagging))
+	}
+	if aws.ToString(in.GrantRead) != `id="123456"` {
+		t.Errorf("Grants not preserved, got %v", in.GrantRead)
+	}
+	if in.StorageClass != types.StorageClassStandardIa || in.ServerSideEncryption != types.ServerSideEncryptionAwsKms || aws.ToString(in.SSEKMSKeyId) != "kms-key" {
+		t.Error("Storage class or encryption not preserved")
+	}
+	if aws.ToString(in.CopySourceIfMatch) != `"old-etag"` {
+		t.Errorf("Expected conditional copy, got %v", in.CopySourceIfMatch)
+	}
+	if result.Status != StatusWritten || aws.ToString(result.NewETag) != `"copy-etag"` || aws.ToString(result.NewVersionId) != "v2" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if result.BytesDownloaded != 0 || result.BytesUploaded != 0 {
+		t.Error("No bytes should be transferred")
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		client.copyInput = nil
+		result, err := OverwriteMetadata(context.Background(), client, "test-bucket", "key", func(info ObjectInfo) (bool, error) {
+			return false, nil
+		})
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Status != StatusSkipped || client.copyInput != nil {
+			t.Error("Expected the object to be skipped without CopyObject")
+		}
+	})
+}
+
+// Test objects larger than 5 GiB are copied in parts
+func TestOverwriteMetadata_MultipartCopy(t *testing.T) {
+	size := int64(12 * 1024 * 1024 * 1024)
+	client := &mockS3Client{
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{}, nil
+		},
+		headObjectFunc: func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{ContentLength: aws.Int64(size), ContentType: aws.String("video/mp4")}, nil
+		},
+	}
+
+	result, err := OverwriteMetadata(context.Background(), client, "test-bucket", "key", func(info ObjectInfo) (bool, error) {
+		info.Metadata["key1"] = aws.String("value1")
+		return true, nil
+	}, WithCannedACL("private"), WithPartSize(1024*1024*1024))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.copyInput != nil {
+		t.Error("CopyObject should not be used above 5 GiB")
+	}
+	if len(client.partRanges) != 12 {
+		t.Fatalf("Expected 12 parts, got %d", len(client.partRanges))
+	}
+	if r := client.partRanges[12]; r != fmt.Sprintf("bytes=%d-%d", 11*1024*1024*1024, size-1) {
+		t.Errorf("Unexpected last range %s", r)
+	}
+	if client.createInput.Metadata["key1"] != "value1" || aws.ToString(client.createInput.ContentType) != "video/mp4" {
+		t.Error("Attributes not applied to the multipart upload")
+	}
+	if len(client.completeInput.MultipartUpload.Parts) != 12 || aws.ToString(result.NewETag) != `"multipart-etag"` {
+		t.Errorf("Unexpected completion %+v", result)
+	}
+}
+
+// Test copy sources are URL-encoded
+func TestCopySourceFor(t *testing.T) {
+	if got := copySourceFor("bucket", "a/b c+d.txt", nil); got != "bucket/a/b%20c%2Bd.txt" {
+		t.Errorf("Unexpected copy source %s", got)
+	}
+	if got := copySourceFor("bucket", "key", aws.String("v+1")); !strings.HasSuffix(got, "?versionId=v%2B1") {
+		t.Errorf("Unexpected copy source %s", got)
+	}
+}
@@ -0,0 +1,75 @@
+package overwrite
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// HeadClient is the optional interface for reading object attributes without the body.
+// *s3.Client implements it.
+type HeadClient interface {
+	HeadObject(ctx context.Context, params *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error)
+}
+
+// DecideFunc decides from an object's attributes whether to download and process it.
+// Returning false skips the object. Tags and ACL are not loaded at this point, and
+// TagCount is nil when it is unknown.
+type DecideFunc func(info ObjectInfo) (bool, error)
+
+// decideBeforeGet runs the transform stamp check and the decide hook against HeadObject,
+// so that skipped objects are never downloaded. Clients without HeadObject are decided
+// by decideAfterGet instead.
+func decideBeforeGet(ctx context.Context, client S3Client, bucket, key string, o *options, result *OverwriteResult) (bool, error) {
+	hc, ok := client.(HeadClient)
+	if !o.decides() || !ok {
+		return false, nil
+	}
+	src, err := headSource(ctx, hc, bucket, key, nil, o, result)
+	if err != nil {
+		return false, err
+	}
+	return runDecide(newDecideInfo(bucket, key, src.getResp), o, result)
+}
+
+// decideAfterGet runs the checks of decideBeforeGet against the GetObject response,
+// before the body is read, for clients without HeadObject
+func decideAfterGet(client S3Client, bucket, key string, getResp *s3.GetObjectOutput, o *options, result *OverwriteResult) (bool, error) {
+	if _, ok := client.(HeadClient); !o.decides() || ok {
+		return false, nil
+	}
+	return runDecide(newDecideInfo(bucket, key, getResp), o, result)
+}
+
+// newDecideInfo builds the ObjectInfo passed to the decide hook
+func newDecideInfo(bucket, key string, getResp *s3.GetObjectOutput) ObjectInfo {
+	info := newObjectInfo(bucket, key, getResp, nil, nil)
+	info.Tags = nil
+	if getResp.TagCount == nil {
+		// HeadObject does not report tags
+		info.TagCount = nil
+	}
+	return info
+}
+
+// runDecide skips objects that already carry the transform stamp, then calls the
+// decide hook, and reports whether the object should be skipped
+func runDecide(info ObjectInfo, o *options, result *OverwriteResult) (bool, error) {
+	if hasStamp(info, o) {
+		result.Status = StatusSkipped
+		return true, nil
+	}
+	if o.decide == nil {
+		return false, nil
+	}
+	proceed, err := o.decide(info)
+	if err != nil {
+		return true, stageError(StageDecide, fmt.Errorf("decide error: %w", err))
+	}
+	if !proceed {
+		result.Status = StatusSkipped
+		return true, nil
+	}
+	return false, nil
+}
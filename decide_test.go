@@ -0,0 +1,108 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Test the decide hook runs against HeadObject before GetObject
+func TestOverwrite_DecideWithHead(t *testing.T) {
+	getObjectCalled := false
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			getObjectCalled = true
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("test content"))}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			return &s3.PutObjectOutput{}, nil
+		},
+		headObjectFunc: func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{
+				ContentLength: aws.Int64(20 * 1024 * 1024),
+				ContentType:   aws.String("video/mp4"),
+				ETag:          aws.String(`"old-etag"`),
+			}, nil
+		},
+	}
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}
+	smallOnly := WithDecide(func(info ObjectInfo) (bool, error) {
+		if info.TagCount != nil || info.Tags != nil || info.ACL != nil {
+			t.Errorf("Tags and ACL should not be loaded, got %+v", info)
+		}
+		return aws.ToInt64(info.ContentLength) <= 10*1024*1024, nil
+	})
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", callback, smallOnly, WithCannedACL("private"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusSkipped || getObjectCalled {
+		t.Error("Expected the object to be skipped without GetObject")
+	}
+	if aws.ToString(result.OldETag) != `"old-etag"` {
+		t.Errorf("Expected OldETag from HeadObject, got %v", result.OldETag)
+	}
+
+	t.Run("proceed", func(t *testing.T) {
+		result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", callback, WithDecide(func(info ObjectInfo) (bool, error) {
+			return aws.ToString(info.ContentType) == "video/mp4", nil
+		}), WithCannedACL("private"))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Status != StatusWritten || !getObjectCalled {
+			t.Error("Expected the object to be overwritten")
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		_, err := OverwriteStream(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+			t.Error("Callback should not be called")
+			return nil
+		}, WithDecide(func(info ObjectInfo) (bool, error) {
+			return false, errors.New("bad object")
+		}))
+		if err == nil || err.Error() != "decide error: bad object" {
+			t.Errorf("Expected decide error, got %v", err)
+		}
+	})
+}
+
+// Test the decide hook falls back to the GetObject response for clients without HeadObject
+func TestOverwrite_DecideWithoutHead(t *testing.T) {
+	body := &countingReader{r: strings.NewReader("test content")}
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:          io.NopCloser(body),
+				ContentLength: aws.Int64(12),
+				TagCount:      aws.Int32(2),
+			}, nil
+		},
+	}
+
+	result, err := Overwrite(context.Background(), struct{ S3Client }{client}, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		t.Error("Callback should not be called")
+		return "", false, nil
+	}, WithDecide(func(info ObjectInfo) (bool, error) {
+		if aws.ToInt64(info.TagCount) != 2 {
+			t.Errorf("Expected TagCount from GetObject, got %v", info.TagCount)
+		}
+		return false, nil
+	}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusSkipped || body.n != 0 {
+		t.Errorf("Expected the object to be skipped without reading the body, read %d bytes", body.n)
+	}
+}
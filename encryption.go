@@ -0,0 +1,86 @@
+package overwrite
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// SSECustomerKey is a customer-provided key for SSE-C encrypted objects
+type SSECustomerKey struct {
+	Algorithm string // usually "AES256"
+	Key       string // base64-encoded 256-bit key
+	KeyMD5    string // base64-encoded MD5 digest of the raw key
+}
+
+// NewSSECustomerKey builds an AES256 SSECustomerKey from a raw 256-bit key
+func NewSSECustomerKey(rawKey []byte) *SSECustomerKey {
+	sum := md5.Sum(rawKey)
+	return &SSECustomerKey{
+		Algorithm: "AES256",
+		Key:       base64.StdEncoding.EncodeToString(rawKey),
+		KeyMD5:    base64.StdEncoding.EncodeToString(sum[:]),
+	}
+}
+
+// SSECustomerKeyProvider supplies the customer key for an SSE-C encrypted object.
+// The same key is used to read the object and to encrypt the new one.
+// Returning nil means the object is not SSE-C encrypted.
+type SSECustomerKeyProvider func(bucket, key string) (*SSECustomerKey, error)
+
+// encryption holds the server-side encryption settings carried over to the new object
+type encryption struct {
+	serverSideEncryption    types.ServerSideEncryption
+	sseKMSKeyId             *string
+	sseKMSEncryptionContext *string
+	bucketKeyEnabled        *bool
+	customerKey             *SSECustomerKey
+}
+
+// encryptionFromGetObject captures the encryption settings reported by GetObject
+func encryptionFromGetObject(getResp *s3.GetObjectOutput, customerKey *SSECustomerKey, kmsContext *string) encryption {
+	enc := encryption{customerKey: customerKey}
+	if customerKey != nil {
+		// SSE-C excludes the other encryption headers
+		return enc
+	}
+	enc.serverSideEncryption = getResp.ServerSideEncryption
+	if enc.serverSideEncryption == types.ServerSideEncryptionAwsKms || enc.serverSideEncryption == types.ServerSideEncryptionAwsKmsDsse {
+		enc.sseKMSKeyId = getResp.SSEKMSKeyId
+		enc.sseKMSEncryptionContext = kmsContext
+		enc.bucketKeyEnabled = getResp.BucketKeyEnabled
+	}
+	return enc
+}
+
+// addEncryptionToInput adds encryption parameters to GetObject, HeadObject or PutObject input
+func addEncryptionToInput(input interface{}, enc encryption) {
+	switch v := input.(type) {
+	case *s3.GetObjectInput:
+		if enc.customerKey != nil {
+			v.SSECustomerAlgorithm = aws.String(enc.customerKey.Algorithm)
+			v.SSECustomerKey = aws.String(enc.customerKey.Key)
+			v.SSECustomerKeyMD5 = aws.String(enc.customerKey.KeyMD5)
+		}
+	case *s3.HeadObjectInput:
+		if enc.customerKey != nil {
+			v.SSECustomerAlgorithm = aws.String(enc.customerKey.Algorithm)
+			v.SSECustomerKey = aws.String(enc.customerKey.Key)
+			v.SSECustomerKeyMD5 = aws.String(enc.customerKey.KeyMD5)
+		}
+	case *s3.PutObjectInput:
+		if enc.customerKey != nil {
+			v.SSECustomerAlgorithm = aws.String(enc.customerKey.Algorithm)
+			v.SSECustomerKey = aws.String(enc.customerKey.Key)
+			v.SSECustomerKeyMD5 = aws.String(enc.customerKey.KeyMD5)
+			return
+		}
+		v.ServerSideEncryption = enc.serverSideEncryption
+		v.SSEKMSKeyId = enc.sseKMSKeyId
+		v.SSEKMSEncryptionContext = enc.sseKMSEncryptionContext
+		v.BucketKeyEnabled = enc.bucketKeyEnabled
+	}
+}
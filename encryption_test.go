@@ -0,0 +1,140 @@
+package overwrite
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test SSE-KMS settings are carried over to the new object
+func TestOverwrite_PreservesKMSEncryption(t *testing.T) {
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:                 io.NopCloser(strings.NewReader("test content")),
+				ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+				SSEKMSKeyId:          aws.String("arn:aws:kms:ap-northeast-1:123456789012:key/abcd"),
+				BucketKeyEnabled:     aws.Bool(true),
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			if input.ServerSideEncryption != types.ServerSideEncryptionAwsKms {
+				t.Errorf("Expected aws:kms encryption, got %q", input.ServerSideEncryption)
+			}
+			if aws.ToString(input.SSEKMSKeyId) != "arn:aws:kms:ap-northeast-1:123456789012:key/abcd" {
+				t.Errorf("KMS key not preserved, got %v", input.SSEKMSKeyId)
+			}
+			if !aws.ToBool(input.BucketKeyEnabled) {
+				t.Error("BucketKeyEnabled not preserved")
+			}
+			if aws.ToString(input.SSEKMSEncryptionContext) != "eyJhIjoiYiJ9" {
+				t.Errorf("Encryption context not applied, got %v", input.SSEKMSEncryptionContext)
+			}
+			if input.SSECustomerKey != nil {
+				t.Error("SSE-C key should not be set")
+			}
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"), WithSSEKMSEncryptionContext("eyJhIjoiYiJ9"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// Test SSE-S3 encryption is carried over without KMS parameters
+func TestOverwrite_PreservesS3Encryption(t *testing.T) {
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:                 io.NopCloser(strings.NewReader("test content")),
+				ServerSideEncryption: types.ServerSideEncryptionAes256,
+				BucketKeyEnabled:     aws.Bool(false),
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			if input.ServerSideEncryption != types.ServerSideEncryptionAes256 {
+				t.Errorf("Expected AES256 encryption, got %q", input.ServerSideEncryption)
+			}
+			if input.SSEKMSKeyId != nil || input.BucketKeyEnabled != nil || input.SSEKMSEncryptionContext != nil {
+				t.Error("KMS parameters should not be set for SSE-S3")
+			}
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"), WithSSEKMSEncryptionContext("eyJhIjoiYiJ9"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// Test SSE-C keys are sent with both GetObject and PutObject
+func TestOverwrite_SSECustomerKey(t *testing.T) {
+	customerKey := NewSSECustomerKey([]byte("0123456789abcdef0123456789abcdef"))
+	getCalled := false
+	putCalled := false
+
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			getCalled = true
+			if aws.ToString(input.SSECustomerKey) != customerKey.Key || aws.ToString(input.SSECustomerKeyMD5) != customerKey.KeyMD5 {
+				t.Error("SSE-C key not sent with GetObject")
+			}
+			return &s3.GetObjectOutput{
+				Body:                 io.NopCloser(strings.NewReader("test content")),
+				SSECustomerAlgorithm: aws.String("AES256"),
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putCalled = true
+			if aws.ToString(input.SSECustomerAlgorithm) != "AES256" || aws.ToString(input.SSECustomerKey) != customerKey.Key {
+				t.Error("SSE-C key not sent with PutObject")
+			}
+			if input.ServerSideEncryption != "" {
+				t.Errorf("ServerSideEncryption should not be set with SSE-C, got %q", input.ServerSideEncryption)
+			}
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"), WithSSECustomerKey(func(bucket, key string) (*SSECustomerKey, error) {
+		return customerKey, nil
+	}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !getCalled || !putCalled {
+		t.Error("Expected GetObject and PutObject to be called")
+	}
+}
+
+// Test NewSSECustomerKey encodes the key and its digest
+func TestNewSSECustomerKey(t *testing.T) {
+	key := NewSSECustomerKey([]byte("0123456789abcdef0123456789abcdef"))
+
+	if key.Algorithm != "AES256" {
+		t.Errorf("Expected AES256, got %s", key.Algorithm)
+	}
+	if key.Key != "MDEyMzQ1Njc4OWFiY2RlZjAxMjM0NTY3ODlhYmNkZWY=" {
+		t.Errorf("Unexpected encoded key %s", key.Key)
+	}
+	if key.KeyMD5 != "hRasmdxgYDKV3nvbahU1MA==" {
+		t.Errorf("Unexpected key digest %s", key.KeyMD5)
+	}
+}
@@ -0,0 +1,111 @@
+package overwrite
+
+import (
+	"errors"
+
+	"github.com/aws/smithy-go"
+)
+
+// Stage identifies the step of an overwrite that failed
+type Stage string
+
+const (
+	StageDownload   Stage = "Download"   // HeadObject, GetObject and reading the body into the temp file
+	StageDecide     Stage = "Decide"     // WithDecide, WithFilter, WithSkipUnchanged and the locked object policy
+	StageGetTagging Stage = "GetTagging" // GetObjectTagging
+	StageGetACL     Stage = "GetACL"     // GetObjectAcl
+	StageCallback   Stage = "Callback"   // the callback, and validating the tags and grants it left
+	StageBackup     Stage = "Backup"     // WithBackup
+	StagePut        Stage = "Put"        // PutObject, CopyObject or the multipart upload
+	StagePutACL     Stage = "PutACL"     // PutObjectAcl restoring WRITE grants
+	StageVerify     Stage = "Verify"     // WithVerify
+	StageRecord     Stage = "Record"     // the WithJournal or WithDryRun entry
+)
+
+// OverwriteError is the error returned by an overwrite. It records the stage that
+// failed and whether the object had already been written, in which case it may be
+// left without its WRITE grants (StagePutACL) or attributes (StageVerify).
+type OverwriteError struct {
+	Stage   Stage
+	Bucket  string
+	Key     string
+	Written bool
+	Err     error
+}
+
+func (e *OverwriteError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *OverwriteError) Unwrap() error {
+	return e.Err
+}
+
+// stageError wraps a non-nil err in an OverwriteError for stage.
+// The outermost stage is the one reported.
+func stageError(stage Stage, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &OverwriteError{Stage: stage, Err: err}
+}
+
+// overwriteError completes the OverwriteError in err with the object and whether it
+// was written, wrapping err in one if it has no stage
+func overwriteError(err error, result *OverwriteResult) error {
+	if err == nil {
+		return nil
+	}
+	written := result.Status == StatusWritten
+	var oe *OverwriteError
+	if errors.As(err, &oe) {
+		oe.Bucket, oe.Key, oe.Written = result.Bucket, result.Key, written
+		return err
+	}
+	return &OverwriteError{Bucket: result.Bucket, Key: result.Key, Written: written, Err: err}
+}
+
+// IsNotFound reports whether err is S3 reporting a missing bucket, object or version
+func IsNotFound(err error) bool {
+	switch errorCode(err) {
+	case "NoSuchKey", "NoSuchBucket", "NoSuchVersion", "NotFound":
+		return true
+	}
+	return httpStatusCode(err) == 404
+}
+
+// IsAccessDenied reports whether err is S3 refusing the request for lack of permission
+func IsAccessDenied(err error) bool {
+	switch errorCode(err) {
+	case "AccessDenied", "Forbidden", "AllAccessDisabled":
+		return true
+	}
+	return httpStatusCode(err) == 403
+}
+
+// IsPreconditionFailed reports whether err is S3 refusing a conditional request
+func IsPreconditionFailed(err error) bool {
+	switch errorCode(err) {
+	case "PreconditionFailed", "ConditionalRequestConflict":
+		return true
+	}
+	return httpStatusCode(err) == 412
+}
+
+// errorCode returns the S3 error code in err, if any
+func errorCode(err error) string {
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ErrorCode()
+	}
+	return ""
+}
+
+// httpStatusCode returns the HTTP status code in err, if any
+func httpStatusCode(err error) int {
+	var statusErr interface{ HTTPStatusCode() int }
+	if errors.As(err, &statusErr) {
+		return statusErr.HTTPStatusCode()
+	}
+	return 0
+}
@@ -0,0 +1,107 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// Test errors report the failed stage and whether the object was already written
+func TestOverwriteError(t *testing.T) {
+	callbackErr := errors.New("bad input")
+	writeGrant := func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+		return &s3.GetObjectAclOutput{Grants: []types.Grant{
+			{Grantee: &types.Grantee{URI: aws.String(AllUsersURI)}, Permission: types.PermissionWrite},
+		}}, nil
+	}
+	tests := []struct {
+		name     string
+		setup    func(client *mockS3Client)
+		callback OverwriteCallback
+		stage    Stage
+		written  bool
+	}{
+		{
+			name: "get object",
+			setup: func(client *mockS3Client) {
+				client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+					return nil, &smithy.GenericAPIError{Code: "NoSuchKey"}
+				}
+			},
+			stage: StageDownload,
+		},
+		{
+			name: "get tagging",
+			setup: func(client *mockS3Client) {
+				client.getObjectTaggingFunc = func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+					return nil, &smithy.GenericAPIError{Code: "AccessDenied"}
+				}
+			},
+			stage: StageGetTagging,
+		},
+		{
+			name: "callback",
+			callback: func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+				return "", false, callbackErr
+			},
+			stage: StageCallback,
+		},
+		{
+			name: "put ACL",
+			setup: func(client *mockS3Client) {
+				client.getObjectAclFunc = writeGrant
+				client.putObjectAclFunc = func(ctx context.Context, input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+					return nil, &smithy.GenericAPIError{Code: "AccessDenied"}
+				}
+			},
+			stage:   StagePutACL,
+			written: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newMockClient(taggedObject())
+			if tt.setup != nil {
+				tt.setup(client)
+			}
+			callback := tt.callback
+			if callback == nil {
+				callback = func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+					return srcFilePath, false, nil
+				}
+			}
+
+			_, err := Overwrite(context.Background(), client, "test-bucket", "key", callback)
+			var oe *OverwriteError
+			if !errors.As(err, &oe) {
+				t.Fatalf("Expected an *OverwriteError, got %v", err)
+			}
+			if oe.Stage != tt.stage || oe.Written != tt.written || oe.Bucket != "test-bucket" || oe.Key != "key" {
+				t.Errorf("Unexpected error %+v", oe)
+			}
+		})
+	}
+}
+
+// Test the S3 error helpers see through wrapping
+func TestErrorHelpers(t *testing.T) {
+	notFound := fmt.Errorf("failed to get object: %w", &smithy.GenericAPIError{Code: "NoSuchKey"})
+	denied := &OverwriteError{Stage: StagePut, Err: &smithy.GenericAPIError{Code: "AccessDenied"}}
+	precondition := fmt.Errorf("%w: %w", ErrConcurrentModification, &smithy.GenericAPIError{Code: "PreconditionFailed"})
+
+	if !IsNotFound(notFound) || IsNotFound(denied) || IsNotFound(errors.New("other")) {
+		t.Error("Unexpected IsNotFound result")
+	}
+	if !IsAccessDenied(denied) || IsAccessDenied(notFound) {
+		t.Error("Unexpected IsAccessDenied result")
+	}
+	if !IsPreconditionFailed(precondition) || IsPreconditionFailed(notFound) {
+		t.Error("Unexpected IsPreconditionFailed result")
+	}
+}
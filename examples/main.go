@@ -27,17 +27,11 @@ func main() {
 	key := "data/config.json"
 
 	// Example: Format JSON file and preserve all attributes
-	err = overwrite.OverwriteS3Object(context.Background(), svc, bucket, key,
+	result, err := overwrite.OverwriteS3Object(context.Background(), svc, bucket, key,
 		func(info overwrite.ObjectInfo, srcFilePath string) (string, bool, error) {
 			fmt.Printf("Processing: %s/%s (size: %d bytes)\n",
 				info.Bucket, info.Key, *info.ContentLength)
 
-			// Skip files larger than 10MB
-			if *info.ContentLength > 10*1024*1024 {
-				fmt.Println("Skipping: file too large")
-				return "", false, nil
-			}
-
 			// Read JSON content
 			data, err := os.ReadFile(srcFilePath)
 			if err != nil {
@@ -76,17 +70,30 @@ func main() {
 			}
 
 			return formattedFile.Name(), true, nil
-		})
+		},
+		// Skip files larger than 10MB before downloading them
+		overwrite.WithDecide(func(info overwrite.ObjectInfo) (bool, error) {
+			if aws.ToInt64(info.ContentLength) > 10*1024*1024 {
+				fmt.Println("Skipping: file too large")
+				return false, nil
+			}
+			return true, nil
+		}))
 
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	fmt.Println("Successfully formatted JSON file")
+	if result.Status == overwrite.StatusSkipped {
+		fmt.Println("JSON file was left unchanged")
+	} else {
+		fmt.Printf("Successfully formatted JSON file (%d -> %d bytes, version %s)\n",
+			result.BytesDownloaded, result.BytesUploaded, aws.ToString(result.NewVersionId))
+	}
 
 	// Example 2: Set public-read ACL while preserving tags
 	publicKey := "public/data.json"
-	err = overwrite.OverwriteS3ObjectWithAcl(context.Background(), svc, bucket, publicKey, "public-read",
+	_, err = overwrite.OverwriteS3ObjectWithAcl(context.Background(), svc, bucket, publicKey, "public-read",
 		func(info overwrite.ObjectInfo, srcFilePath string) (string, bool, error) {
 			fmt.Printf("Making public: %s/%s\n", info.Bucket, info.Key)
 
@@ -114,59 +121,48 @@ func main() {
 }
 
 func processLogs(svc *s3.Client, bucket, prefix string) {
-	// List objects with prefix
-	resp, err := svc.ListObjectsV2(context.Background(), &s3.ListObjectsV2Input{
-		Bucket: aws.String(bucket),
-		Prefix: aws.String(prefix),
-	})
-	if err != nil {
-		log.Printf("Error listing objects: %v", err)
-		return
-	}
+	// Process every log file under the prefix with 8 workers
+	summary, err := overwrite.OverwritePrefix(context.Background(), svc, bucket, prefix,
+		func(info overwrite.ObjectInfo, srcFilePath string) (string, bool, error) {
+			// Example: Add processing timestamp to logs
+			content, err := os.ReadFile(srcFilePath)
+			if err != nil {
+				return "", false, err
+			}
+
+			// Add timestamp header
+			header := fmt.Sprintf("# Processed at %s\n", time.Now().Format(time.RFC3339))
+			newContent := append([]byte(header), content...)
 
-	// Process each log file
-	for _, obj := range resp.Contents {
-		if *obj.Size == 0 {
-			continue // Skip empty files
-		}
-
-		err := overwrite.OverwriteS3Object(context.Background(), svc, bucket, *obj.Key,
-			func(info overwrite.ObjectInfo, srcFilePath string) (string, bool, error) {
-				// Example: Add processing timestamp to logs
-				content, err := os.ReadFile(srcFilePath)
-				if err != nil {
-					return "", false, err
-				}
-
-				// Add timestamp header
-				header := fmt.Sprintf("# Processed at %s\n", time.Now().Format(time.RFC3339))
-				newContent := append([]byte(header), content...)
-
-				// Create new file with processed content
-				processedFile, err := os.CreateTemp("", "processed-*.log")
-				if err != nil {
-					return "", false, err
-				}
-				defer processedFile.Close()
-
-				if _, err := processedFile.Write(newContent); err != nil {
-					os.Remove(processedFile.Name())
-					return "", false, err
-				}
-
-				// Update metadata
-				if info.Metadata == nil {
-					info.Metadata = make(map[string]*string)
-				}
-				info.Metadata["processed"] = aws.String("true")
-
-				return processedFile.Name(), true, nil
-			})
-
-		if err != nil {
-			log.Printf("Error processing %s: %v", *obj.Key, err)
-		} else {
-			fmt.Printf("Processed: %s\n", *obj.Key)
-		}
+			// Create new file with processed content
+			processedFile, err := os.CreateTemp("", "processed-*.log")
+			if err != nil {
+				return "", false, err
+			}
+			defer processedFile.Close()
+
+			if _, err := processedFile.Write(newContent); err != nil {
+				os.Remove(processedFile.Name())
+				return "", false, err
+			}
+
+			// Update metadata
+			info.Metadata["processed"] = aws.String("true")
+
+			return processedFile.Name(), true, nil
+		},
+		// Skip empty files
+		overwrite.WithFilter(overwrite.Filter{MinSize: 1}),
+		overwrite.WithWorkers(8),
+		overwrite.WithMaxFailures(10),
+	)
+
+	for _, keyErr := range summary.Errors {
+		log.Printf("Error processing %s: %v", keyErr.Key, keyErr.Err)
+	}
+	if err != nil {
+		log.Printf("Batch stopped: %v", err)
 	}
+	fmt.Printf("Processed %d logs: %d written, %d skipped, %d failed\n",
+		summary.Processed, summary.Written, summary.Skipped, summary.Failed)
 }
@@ -0,0 +1,198 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Filter selects the objects OverwritePrefix processes. Zero-valued fields match
+// every object, and an object must match all the fields that are set.
+// Key, size, LastModified and storage class are checked from the listing alone;
+// content type and metadata need HeadObject, and tags need GetObjectTagging, which
+// are only called for objects that pass the cheaper checks.
+type Filter struct {
+	Include       []string // glob patterns (path.Match); the key must match at least one
+	Exclude       []string // glob patterns; keys matching any are skipped
+	IncludeRegexp []*regexp.Regexp
+	ExcludeRegexp []*regexp.Regexp
+
+	MinSize int64
+	MaxSize int64 // zero means no limit
+
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+
+	StorageClasses []types.StorageClass
+	ContentTypes   []string // glob patterns such as "image/*"; parameters are ignored
+
+	// Tags and Metadata require each key to be present and, unless the value is nil,
+	// to have that value. Metadata keys are case-insensitive.
+	Tags     map[string]*string
+	Metadata map[string]*string
+}
+
+// checkFilter validates the configured filter against the client
+func checkFilter(client BatchClient, o *options) error {
+	f := o.filter
+	if f == nil {
+		return nil
+	}
+	if _, ok := client.(HeadClient); f.needsHead() && !ok {
+		return errors.New("filtering on content type or metadata requires a client implementing HeadClient")
+	}
+	return f.validate()
+}
+
+// validate checks the glob patterns
+func (f *Filter) validate() error {
+	for _, patterns := range [][]string{f.Include, f.Exclude, f.ContentTypes} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid filter pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return nil
+}
+
+// needsHead reports whether the filter checks attributes only HeadObject returns
+func (f *Filter) needsHead() bool {
+	return len(f.ContentTypes) > 0 || len(f.Metadata) > 0
+}
+
+// matchListed checks the attributes reported by ListObjectsV2
+func (f *Filter) matchListed(obj types.Object) bool {
+	key := aws.ToString(obj.Key)
+	if len(f.Include) > 0 && !matchAnyGlob(f.Include, key) {
+		return false
+	}
+	if matchAnyGlob(f.Exclude, key) {
+		return false
+	}
+	if len(f.IncludeRegexp) > 0 && !matchAnyRegexp(f.IncludeRegexp, key) {
+		return false
+	}
+	if matchAnyRegexp(f.ExcludeRegexp, key) {
+		return false
+	}
+
+	size := aws.ToInt64(obj.Size)
+	if size < f.MinSize || (f.MaxSize > 0 && size > f.MaxSize) {
+		return false
+	}
+
+	modified := aws.ToTime(obj.LastModified)
+	if !f.ModifiedAfter.IsZero() && !modified.After(f.ModifiedAfter) {
+		return false
+	}
+	if !f.ModifiedBefore.IsZero() && !modified.Before(f.ModifiedBefore) {
+		return false
+	}
+
+	if len(f.StorageClasses) > 0 {
+		class := types.StorageClass(obj.StorageClass)
+		if class == "" {
+			class = types.StorageClassStandard
+		}
+		found := false
+		for _, c := range f.StorageClasses {
+			found = found || c == class
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// matchHead checks the attributes reported by HeadObject
+func (f *Filter) matchHead(getResp *s3.GetObjectOutput) bool {
+	if len(f.ContentTypes) > 0 {
+		contentType, _, _ := strings.Cut(aws.ToString(getResp.ContentType), ";")
+		if !matchAnyGlob(f.ContentTypes, strings.TrimSpace(contentType)) {
+			return false
+		}
+	}
+	metadata := make(map[string]string, len(getResp.Metadata))
+	for k, v := range getResp.Metadata {
+		metadata[strings.ToLower(k)] = v
+	}
+	return matchAttributes(f.Metadata, metadata, strings.ToLower)
+}
+
+// matchTags checks the object's tags
+func (f *Filter) matchTags(tags []types.Tag) bool {
+	return matchAttributes(f.Tags, tagsToMap(tags), func(k string) string { return k })
+}
+
+// matchAttributes reports whether attrs contains every key in want with the wanted value
+func matchAttributes(want map[string]*string, attrs map[string]string, normalize func(string) string) bool {
+	for k, v := range want {
+		got, ok := attrs[normalize(k)]
+		if !ok || (v != nil && got != *v) {
+			return false
+		}
+	}
+	return true
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func matchAnyRegexp(patterns []*regexp.Regexp, name string) bool {
+	for _, re := range patterns {
+		if re.MatchString(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectObject applies the filter to a listed object, calling HeadObject and
+// GetObjectTagging only when the filter needs them
+func selectObject(ctx context.Context, client BatchClient, bucket string, obj types.Object, o *options) (bool, error) {
+	f := o.filter
+	if f == nil {
+		return true, nil
+	}
+	if !f.matchListed(obj) {
+		return false, nil
+	}
+	key := aws.ToString(obj.Key)
+
+	if f.needsHead() {
+		src, err := headSource(ctx, client.(HeadClient), bucket, key, nil, o, &OverwriteResult{})
+		if err != nil {
+			return false, err
+		}
+		if !f.matchHead(src.getResp) {
+			return false, nil
+		}
+	}
+
+	if len(f.Tags) > 0 {
+		tags, err := fetchTags(ctx, client, bucket, key, nil, o)
+		if err != nil {
+			return false, err
+		}
+		if !f.matchTags(tags) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
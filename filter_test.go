@@ -0,0 +1,125 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"path"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test the checks made from listing data alone
+func TestFilter_MatchListed(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	obj := types.Object{
+		Key:          aws.String("images/2024/photo.jpg"),
+		Size:         aws.Int64(2048),
+		LastModified: aws.Time(now),
+		StorageClass: types.ObjectStorageClassStandard,
+	}
+
+	tests := []struct {
+		name     string
+		filter   Filter
+		expected bool
+	}{
+		{"empty", Filter{}, true},
+		{"include", Filter{Include: []string{"images/*/*.jpg"}}, true},
+		{"include mismatch", Filter{Include: []string{"images/*.jpg"}}, false},
+		{"exclude", Filter{Exclude: []string{"*/2024/*"}}, false},
+		{"include regexp", Filter{IncludeRegexp: []*regexp.Regexp{regexp.MustCompile(`\.jpe?g$`)}}, true},
+		{"exclude regexp", Filter{ExcludeRegexp: []*regexp.Regexp{regexp.MustCompile(`^images/`)}}, false},
+		{"min size", Filter{MinSize: 4096}, false},
+		{"max size", Filter{MaxSize: 1024}, false},
+		{"size range", Filter{MinSize: 1024, MaxSize: 4096}, true},
+		{"modified after", Filter{ModifiedAfter: now.Add(-time.Hour)}, true},
+		{"modified before", Filter{ModifiedBefore: now}, false},
+		{"storage class", Filter{StorageClasses: []types.StorageClass{types.StorageClassStandard}}, true},
+		{"storage class mismatch", Filter{StorageClasses: []types.StorageClass{types.StorageClassGlacier}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.matchListed(obj); got != tt.expected {
+				t.Errorf("matchListed() = %v, expected %v", got, tt.expected)
+			}
+		})
+	}
+}
+
+// Test HeadObject and GetObjectTagging are only called when needed
+func TestOverwritePrefix_Filter(t *testing.T) {
+	var headed, tagged []string
+	client := newMockClient(mockObject{body: "test content"})
+	client.keys = []string{"a.jpg", "b.jpg", "c.png", "d.jpg"}
+	client.headObjectFunc = func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+		key := aws.ToString(input.Key)
+		headed = append(headed, key)
+		out := &s3.HeadObjectOutput{ContentType: aws.String("image/jpeg; charset=binary"), Metadata: map[string]string{"stage": "raw"}}
+		if key == "b.jpg" {
+			out.ContentType = aws.String("text/plain")
+		}
+		return out, nil
+	}
+	client.getObjectTaggingFunc = func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+		key := aws.ToString(input.Key)
+		tagged = append(tagged, key)
+		if key == "d.jpg" {
+			return &s3.GetObjectTaggingOutput{}, nil
+		}
+		return &s3.GetObjectTaggingOutput{TagSet: []types.Tag{{Key: aws.String("team"), Value: aws.String("web")}}}, nil
+	}
+
+	var processed []string
+	summary, err := OverwritePrefix(context.Background(), client, "test-bucket", "", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		processed = append(processed, info.Key)
+		return "", false, nil
+	}, WithCannedACL("private"), WithWorkers(1), WithFilter(Filter{
+		Include:      []string{"*.jpg"},
+		ContentTypes: []string{"image/*"},
+		Metadata:     map[string]*string{"Stage": aws.String("raw")},
+		Tags:         map[string]*string{"team": nil},
+	}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(processed, ",") != "a.jpg" || summary.Filtered != 3 || summary.Processed != 1 {
+		t.Errorf("Unexpected selection %v, summary %+v", processed, summary)
+	}
+	if strings.Join(headed, ",") != "a.jpg,b.jpg,d.jpg" {
+		t.Errorf("HeadObject should only be called for listed matches, got %v", headed)
+	}
+	if strings.Join(tagged, ",") != "a.jpg,d.jpg" {
+		t.Errorf("GetObjectTagging should only be called after HeadObject matches, got %v", tagged)
+	}
+}
+
+// Test invalid filters are rejected before listing
+func TestOverwritePrefix_InvalidFilter(t *testing.T) {
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return "", false, nil
+	}
+
+	client := newMockClient(mockObject{})
+	client.keys = numberedKeys("", 1)
+	_, err := OverwritePrefix(context.Background(), client, "test-bucket", "", callback, WithFilter(Filter{Include: []string{"["}}))
+	if err == nil || !errors.Is(err, path.ErrBadPattern) {
+		t.Errorf("Expected bad pattern error, got %v", err)
+	}
+
+	// Without HeadObject, content types cannot be checked
+	_, err = OverwritePrefix(context.Background(), struct{ BatchClient }{client}, "test-bucket", "", callback, WithFilter(Filter{ContentTypes: []string{"image/*"}}))
+	if err == nil || !strings.Contains(err.Error(), "HeadClient") {
+		t.Errorf("Expected HeadClient error, got %v", err)
+	}
+	if len(client.listed) != 0 {
+		t.Error("Objects should not be listed with an invalid filter")
+	}
+}
@@ -0,0 +1,213 @@
+package overwrite
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+// ErrNoPreviousVersion is returned (wrapped) by Rollback for journal entries whose
+// previous version was not kept, because the bucket is not versioned
+var ErrNoPreviousVersion = errors.New("previous version was not kept")
+
+// JournalEntry records the version an overwrite replaced
+type JournalEntry struct {
+	Time              time.Time `json:"time"`
+	Bucket            string    `json:"bucket"`
+	Key               string    `json:"key"`
+	PreviousVersionId string    `json:"previous_version_id,omitempty"`
+	PreviousETag      string    `json:"previous_etag,omitempty"`
+	NewVersionId      string    `json:"new_version_id,omitempty"`
+	NewETag           string    `json:"new_etag,omitempty"`
+}
+
+// Journal receives an entry for every object written with WithJournal.
+// Record may be called from several goroutines at once.
+type Journal interface {
+	Record(entry JournalEntry) error
+}
+
+// JournalFunc adapts a function to the Journal interface
+type JournalFunc func(entry JournalEntry) error
+
+// Record calls f(entry)
+func (f JournalFunc) Record(entry JournalEntry) error {
+	return f(entry)
+}
+
+// FileJournal appends journal entries to a JSONL file
+type FileJournal struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// OpenJournal opens the JSONL journal at path for appending, creating it if needed
+func OpenJournal(path string) (*FileJournal, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open journal: %w", err)
+	}
+	return &FileJournal{file: file}, nil
+}
+
+// Record appends entry as a single line and syncs the file
+func (j *FileJournal) Record(entry JournalEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return j.file.Sync()
+}
+
+// Close closes the journal file
+func (j *FileJournal) Close() error {
+	return j.file.Close()
+}
+
+// ReadJournal reads the entries of a JSONL journal written by FileJournal
+func ReadJournal(path string) ([]JournalEntry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	defer file.Close()
+
+	var entries []JournalEntry
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry JournalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse journal line %d: %w", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal: %w", err)
+	}
+	return entries, nil
+}
+
+// recordJournal records a written object in the configured journal
+func recordJournal(result *OverwriteResult, o *options) error {
+	if o.journal == nil || result.Status != StatusWritten {
+		return nil
+	}
+	err := o.journal.Record(JournalEntry{
+		Time:              time.Now().UTC(),
+		Bucket:            result.Bucket,
+		Key:               result.Key,
+		PreviousVersionId: aws.ToString(result.OldVersionId),
+		PreviousETag:      aws.ToString(result.OldETag),
+		NewVersionId:      aws.ToString(result.NewVersionId),
+		NewETag:           aws.ToString(result.NewETag),
+	})
+	if err != nil {
+		return stageError(StageRecord, fmt.Errorf("failed to record journal entry: %w", err))
+	}
+	return nil
+}
+
+// rollbackTarget is the version a key is rolled back to
+type rollbackTarget struct {
+	bucket   string
+	key      string
+	previous string // version before the first journaled overwrite
+	current  string // version written by the last journaled overwrite
+}
+
+// Rollback restores every key in the journal to the version it had before its first
+// journaled overwrite, with that version's metadata, headers, tags and ACL. The old
+// version is copied over the current one, so the bucket must be versioned. A key is
+// only rolled back while its current version is the one the journal last recorded;
+// otherwise it fails with an error wrapping ErrConcurrentModification. Keys are
+// processed by WithWorkers workers, and failures are recorded in the summary.
+func Rollback(ctx context.Context, client CopyClient, entries []JournalEntry, opts ...Option) (*BatchSummary, error) {
+	o := newOptions(opts)
+
+	var targets []*rollbackTarget
+	byKey := map[string]*rollbackTarget{}
+	for _, entry := range entries {
+		id := entry.Bucket + "/" + entry.Key
+		target := byKey[id]
+		if target == nil {
+			target = &rollbackTarget{bucket: entry.Bucket, key: entry.Key, previous: entry.PreviousVersionId}
+			byKey[id] = target
+			targets = append(targets, target)
+		}
+		target.current = entry.NewVersionId
+	}
+
+	summary := &BatchSummary{}
+	var mu sync.Mutex
+	work := make(chan *rollbackTarget)
+	var wg sync.WaitGroup
+	for i := 0; i < o.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for target := range work {
+				result, err := rollbackKey(ctx, client, target, o)
+				mu.Lock()
+				summary.Processed++
+				if err != nil {
+					summary.Failed++
+					summary.Errors = append(summary.Errors, KeyError{Key: target.key, Err: err})
+				} else if result.Status == StatusWritten {
+					summary.Written++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for _, target := range targets {
+		select {
+		case work <- target:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(work)
+	wg.Wait()
+	return summary, ctx.Err()
+}
+
+// rollbackKey copies the target's previous version over its current version
+func rollbackKey(ctx context.Context, client CopyClient, target *rollbackTarget, o *options) (*OverwriteResult, error) {
+	result := &OverwriteResult{Bucket: target.bucket, Key: target.key, Attempts: 1}
+	err := rollback(ctx, client, target, o, result)
+	return result, overwriteError(err, result)
+}
+
+// rollback performs the rollback of a single key
+func rollback(ctx context.Context, client CopyClient, target *rollbackTarget, o *options, result *OverwriteResult) error {
+	if target.previous == "" || target.previous == "null" {
+		return stageError(StageDecide, fmt.Errorf("failed to roll back object: %w", ErrNoPreviousVersion))
+	}
+
+	current, err := headSource(ctx, client, target.bucket, target.key, nil, o, result)
+	if err != nil {
+		return err
+	}
+	if version := aws.ToString(current.getResp.VersionId); version != target.current {
+		return stageError(StageDecide, fmt.Errorf("failed to roll back object: %w: current version is %q, journal recorded %q",
+			ErrConcurrentModification, version, target.current))
+	}
+
+	return restore(ctx, client, target.bucket, target.key, aws.String(target.previous), target.bucket, target.key, o, result)
+}
@@ -0,0 +1,127 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Test written objects are recorded in a JSONL journal that ReadJournal reads back
+func TestWithJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal.jsonl")
+	journal, err := OpenJournal(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	client := newMockClient(taggedObject())
+	getObject := client.getObjectFunc
+	client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+		resp, err := getObject(ctx, input)
+		resp.VersionId = aws.String("v1")
+		return resp, err
+	}
+	client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+		return &s3.PutObjectOutput{ETag: aws.String(`"new-etag"`), VersionId: aws.String("v2")}, nil
+	}
+
+	for _, key := range []string{"a.txt", "b.txt"} {
+		_, err := Overwrite(context.Background(), client, "test-bucket", key, func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			if key == "b.txt" {
+				return "", false, nil
+			}
+			return srcFilePath, false, nil
+		}, WithJournal(journal))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+	if err := journal.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entries, err := ReadJournal(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("Expected only the written object, got %+v", entries)
+	}
+	e := entries[0]
+	if e.Bucket != "test-bucket" || e.Key != "a.txt" || e.PreviousVersionId != "v1" || e.NewVersionId != "v2" ||
+		e.PreviousETag != `"old-etag"` || e.NewETag != `"new-etag"` || e.Time.IsZero() {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+
+	t.Run("journal error", func(t *testing.T) {
+		journalErr := errors.New("disk full")
+		_, err := Overwrite(context.Background(), client, "test-bucket", "a.txt", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			return srcFilePath, false, nil
+		}, WithJournal(JournalFunc(func(entry JournalEntry) error {
+			return journalErr
+		})))
+		if !errors.Is(err, journalErr) {
+			t.Errorf("Expected the journal error, got %v", err)
+		}
+	})
+}
+
+// Test Rollback copies the version before the first journaled overwrite over the current one
+func TestRollback(t *testing.T) {
+	client := newMockClient(taggedObject())
+	current := map[string]string{"a.txt": "v3", "b.txt": "v9", "c.txt": "v2"}
+	client.headObjectFunc = func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+		version := aws.ToString(input.VersionId)
+		if version == "" {
+			version = current[aws.ToString(input.Key)]
+		}
+		return &s3.HeadObjectOutput{
+			ContentLength: aws.Int64(8),
+			ETag:          aws.String(`"etag-` + version + `"`),
+			VersionId:     aws.String(version),
+			Metadata:      map[string]string{"version": version},
+		}, nil
+	}
+
+	entries := []JournalEntry{
+		{Bucket: "test-bucket", Key: "a.txt", PreviousVersionId: "v1", NewVersionId: "v2"},
+		{Bucket: "test-bucket", Key: "a.txt", PreviousVersionId: "v2", NewVersionId: "v3"},
+		{Bucket: "test-bucket", Key: "b.txt", PreviousVersionId: "v1", NewVersionId: "v2"},
+		{Bucket: "test-bucket", Key: "c.txt", NewVersionId: "v2"},
+	}
+	summary, err := Rollback(context.Background(), client, entries, WithWorkers(1))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if summary.Processed != 3 || summary.Written != 1 || summary.Failed != 2 {
+		t.Fatalf("Unexpected summary %+v", summary)
+	}
+	if len(client.copyInputs) != 1 {
+		t.Fatalf("Expected one copy, got %d", len(client.copyInputs))
+	}
+	in := client.copyInputs[0]
+	if aws.ToString(in.Key) != "a.txt" || aws.ToString(in.CopySource) != "test-bucket/a.txt?versionId=v1" {
+		t.Errorf("Unexpected copy %s from %s", aws.ToString(in.Key), aws.ToString(in.CopySource))
+	}
+	if in.Metadata["version"] != "v1" || aws.ToString(in.CopySourceIfMatch) != `"etag-v1"` {
+		t.Errorf("Expected the attributes of v1, got %v", in.Metadata)
+	}
+	for _, keyErr := range summary.Errors {
+		switch keyErr.Key {
+		case "b.txt":
+			if !errors.Is(keyErr.Err, ErrConcurrentModification) {
+				t.Errorf("Expected a concurrent modification for b.txt, got %v", keyErr.Err)
+			}
+		case "c.txt":
+			if !errors.Is(keyErr.Err, ErrNoPreviousVersion) {
+				t.Errorf("Expected no previous version for c.txt, got %v", keyErr.Err)
+			}
+		default:
+			t.Errorf("Unexpected error %v", keyErr)
+		}
+	}
+}
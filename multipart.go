@@ -0,0 +1,262 @@
+package overwrite
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	// maxPutObjectSize is the largest object a single PutObject can upload
+	maxPutObjectSize = 5 * 1024 * 1024 * 1024
+	// minPartSize is the smallest part S3 accepts (except for the last part)
+	minPartSize = 5 * 1024 * 1024
+	// maxParts is the maximum number of parts in a multipart upload
+	maxParts = 10000
+
+	defaultMultipartThreshold   = maxPutObjectSize
+	defaultPartSize             = 64 * 1024 * 1024
+	defaultMultipartConcurrency = 4
+	defaultPartRetries          = 2
+)
+
+// MultipartClient is the optional interface for multipart uploads.
+// *s3.Client implements it; clients that don't are limited to PutObject.
+type MultipartClient interface {
+	CreateMultipartUpload(ctx context.Context, params *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error)
+	UploadPart(ctx context.Context, params *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error)
+	CompleteMultipartUpload(ctx context.Context, params *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error)
+	AbortMultipartUpload(ctx context.Context, params *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error)
+}
+
+// createMultipartInputFromPut builds CreateMultipartUpload input carrying every
+// attribute of the equivalent PutObject input
+func createMultipartInputFromPut(putInput *s3.PutObjectInput) *s3.CreateMultipartUploadInput {
+	return &s3.CreateMultipartUploadInput{
+		Bucket:                    putInput.Bucket,
+		Key:                       putInput.Key,
+		ACL:                       putInput.ACL,
+		BucketKeyEnabled:          putInput.BucketKeyEnabled,
+		CacheControl:              putInput.CacheControl,
+		ChecksumAlgorithm:         putInput.ChecksumAlgorithm,
+		ContentDisposition:        putInput.ContentDisposition,
+		ContentEncoding:           putInput.ContentEncoding,
+		ContentLanguage:           putInput.ContentLanguage,
+		ContentType:               putInput.ContentType,
+		Expires:                   putInput.Expires,
+		GrantFullControl:          putInput.GrantFullControl,
+		GrantRead:                 putInput.GrantRead,
+		GrantReadACP:              putInput.GrantReadACP,
+		GrantWriteACP:             putInput.GrantWriteACP,
+		Metadata:                  putInput.Metadata,
+		ObjectLockLegalHoldStatus: putInput.ObjectLockLegalHoldStatus,
+		ObjectLockMode:            putInput.ObjectLockMode,
+		ObjectLockRetainUntilDate: putInput.ObjectLockRetainUntilDate,
+		SSECustomerAlgorithm:      putInput.SSECustomerAlgorithm,
+		SSECustomerKey:            putInput.SSECustomerKey,
+		SSECustomerKeyMD5:         putInput.SSECustomerKeyMD5,
+		SSEKMSEncryptionContext:   putInput.SSEKMSEncryptionContext,
+		SSEKMSKeyId:               putInput.SSEKMSKeyId,
+		ServerSideEncryption:      putInput.ServerSideEncryption,
+		StorageClass:              putInput.StorageClass,
+		Tagging:                   putInput.Tagging,
+		WebsiteRedirectLocation:   putInput.WebsiteRedirectLocation,
+	}
+}
+
+// partSizeFor grows the configured part size so that size fits in maxParts parts
+func partSizeFor(size, partSize int64) int64 {
+	if partSize < minPartSize {
+		partSize = minPartSize
+	}
+	for (size+partSize-1)/partSize > maxParts {
+		partSize *= 2
+	}
+	return partSize
+}
+
+// partUploader uploads the parts of a multipart upload and returns them in order
+type partUploader func(ctx context.Context, uploadID *string) ([]types.CompletedPart, error)
+
+// uploadMultipart runs a multipart upload described by putInput.
+// The upload is aborted if any part or the completion fails.
+func uploadMultipart(
+	ctx context.Context,
+	client MultipartClient,
+	putInput *s3.PutObjectInput,
+	uploadParts partUploader,
+) (*s3.CompleteMultipartUploadOutput, error) {
+	createResp, err := client.CreateMultipartUpload(ctx, createMultipartInputFromPut(putInput))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create multipart upload: %w", err)
+	}
+	uploadID := createResp.UploadId
+
+	completeResp, err := func() (*s3.CompleteMultipartUploadOutput, error) {
+		parts, err := uploadParts(ctx, uploadID)
+		if err != nil {
+			return nil, err
+		}
+		completeResp, err := client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+			Bucket:               putInput.Bucket,
+			Key:                  putInput.Key,
+			UploadId:             uploadID,
+			MultipartUpload:      &types.CompletedMultipartUpload{Parts: parts},
+			IfMatch:              putInput.IfMatch,
+			SSECustomerAlgorithm: putInput.SSECustomerAlgorithm,
+			SSECustomerKey:       putInput.SSECustomerKey,
+			SSECustomerKeyMD5:    putInput.SSECustomerKeyMD5,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to complete multipart upload: %w", err)
+		}
+		return completeResp, nil
+	}()
+	if err != nil {
+		// Abort even if ctx was cancelled so no orphaned parts are billed
+		_, _ = client.AbortMultipartUpload(context.WithoutCancel(ctx), &s3.AbortMultipartUploadInput{
+			Bucket:   putInput.Bucket,
+			Key:      putInput.Key,
+			UploadId: uploadID,
+		})
+		return nil, err
+	}
+	return completeResp, nil
+}
+
+// partGroup uploads parts in parallel, bounded by the multipart concurrency,
+// and cancels the remaining parts after the first failure
+type partGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	slots  chan struct{}
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	parts    []types.CompletedPart
+	firstErr error
+}
+
+func newPartGroup(ctx context.Context, concurrency int) *partGroup {
+	ctx, cancel := context.WithCancel(ctx)
+	return &partGroup{ctx: ctx, cancel: cancel, slots: make(chan struct{}, concurrency)}
+}
+
+// Go starts upload in the background once a slot is free.
+// It returns false if the group has already failed.
+func (g *partGroup) Go(upload func(ctx context.Context) (types.CompletedPart, error)) bool {
+	select {
+	case g.slots <- struct{}{}:
+	case <-g.ctx.Done():
+		return false
+	}
+	g.wg.Add(1)
+	go func() {
+		defer func() {
+			<-g.slots
+			g.wg.Done()
+		}()
+		part, err := upload(g.ctx)
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		if err != nil {
+			if g.firstErr == nil {
+				g.firstErr = err
+				g.cancel()
+			}
+			return
+		}
+		g.parts = append(g.parts, part)
+	}()
+	return true
+}
+
+// Wait waits for all parts and returns them sorted by part number
+func (g *partGroup) Wait() ([]types.CompletedPart, error) {
+	g.wg.Wait()
+	defer g.cancel()
+	if g.firstErr != nil {
+		return nil, g.firstErr
+	}
+	if err := g.ctx.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(g.parts, func(i, j int) bool {
+		return aws.ToInt32(g.parts[i].PartNumber) < aws.ToInt32(g.parts[j].PartNumber)
+	})
+	return g.parts, nil
+}
+
+// fileParts returns a partUploader for size bytes of body
+func fileParts(client MultipartClient, putInput *s3.PutObjectInput, body io.ReaderAt, size int64, o *options) partUploader {
+	return func(ctx context.Context, uploadID *string) ([]types.CompletedPart, error) {
+		partSize := partSizeFor(size, o.partSize)
+		partCount := max(int((size+partSize-1)/partSize), 1)
+
+		g := newPartGroup(ctx, o.multipartConcurrency)
+		for i := 1; i <= partCount; i++ {
+			partNumber := int32(i)
+			offset := int64(i-1) * partSize
+			section := io.NewSectionReader(body, offset, min(partSize, size-offset))
+			started := g.Go(func(ctx context.Context) (types.CompletedPart, error) {
+				return uploadPart(ctx, client, putInput, uploadID, partNumber, section, o.partRetryPolicy())
+			})
+			if !started {
+				break
+			}
+		}
+		return g.Wait()
+	}
+}
+
+// uploadPart uploads a single part, retrying it under policy
+func uploadPart(
+	ctx context.Context,
+	client MultipartClient,
+	putInput *s3.PutObjectInput,
+	uploadID *string,
+	partNumber int32,
+	section *io.SectionReader,
+	policy RetryPolicy,
+) (types.CompletedPart, error) {
+	var part types.CompletedPart
+	err := retryWith(ctx, policy, func(int) error {
+		if _, err := section.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		partResp, err := client.UploadPart(ctx, &s3.UploadPartInput{
+			Bucket:               putInput.Bucket,
+			Key:                  putInput.Key,
+			UploadId:             uploadID,
+			PartNumber:           aws.Int32(partNumber),
+			Body:                 section,
+			ContentLength:        aws.Int64(section.Size()),
+			ChecksumAlgorithm:    putInput.ChecksumAlgorithm,
+			SSECustomerAlgorithm: putInput.SSECustomerAlgorithm,
+			SSECustomerKey:       putInput.SSECustomerKey,
+			SSECustomerKeyMD5:    putInput.SSECustomerKeyMD5,
+		})
+		if err != nil {
+			return err
+		}
+		part = types.CompletedPart{
+			ETag:           partResp.ETag,
+			PartNumber:     aws.Int32(partNumber),
+			ChecksumCRC32:  partResp.ChecksumCRC32,
+			ChecksumCRC32C: partResp.ChecksumCRC32C,
+			ChecksumSHA1:   partResp.ChecksumSHA1,
+			ChecksumSHA256: partResp.ChecksumSHA256,
+		}
+		return nil
+	})
+	if err != nil {
+		return types.CompletedPart{}, fmt.Errorf("failed to upload part %d: %w", partNumber, err)
+	}
+	return part, nil
+}
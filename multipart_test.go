@@ -0,0 +1,234 @@
+package overwrite
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
+)
+
+// writeLargeFile writes size bytes of patterned content to a temp file
+func writeLargeFile(t *testing.T, size int) (string, []byte) {
+	t.Helper()
+	content := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+	path := t.TempDir() + "/large.bin"
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path, content
+}
+
+// Test large files are uploaded in parts with all attributes preserved
+func TestOverwrite_MultipartUpload(t *testing.T) {
+	largePath, content := writeLargeFile(t, 12*1024*1024)
+
+	putObjectCalled := false
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:                 io.NopCloser(strings.NewReader("small")),
+				ETag:                 aws.String(`"old-etag"`),
+				ContentType:          aws.String("application/octet-stream"),
+				CacheControl:         aws.String("max-age=60"),
+				StorageClass:         types.StorageClassStandardIa,
+				ServerSideEncryption: types.ServerSideEncryptionAwsKms,
+				SSEKMSKeyId:          aws.String("kms-key"),
+				Metadata:             map[string]string{"key1": "value1"},
+				TagCount:             aws.Int32(1),
+			}, nil
+		},
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []types.Tag{{Key: aws.String("tag1"), Value: aws.String("value1")}},
+			}, nil
+		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{
+				Grants: []types.Grant{
+					{
+						Grantee:    &types.Grantee{Type: types.TypeCanonicalUser, ID: aws.String("123456")},
+						Permission: types.PermissionRead,
+					},
+				},
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putObjectCalled = true
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return largePath, false, nil
+	}, WithMultipartThreshold(1024), WithPartSize(5*1024*1024), WithConditionalWrite())
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if putObjectCalled {
+		t.Error("PutObject should not be used above the multipart threshold")
+	}
+	if len(client.parts) != 3 {
+		t.Errorf("Expected 3 parts, got %d", len(client.parts))
+	}
+	if !bytes.Equal(client.assembled(), content) {
+		t.Error("Uploaded parts do not match the file content")
+	}
+
+	in := client.createInput
+	if aws.ToString(in.ContentType) != "application/octet-stream" || aws.ToString(in.CacheControl) != "max-age=60" {
+		t.Errorf("Headers not preserved: %v, %v", in.ContentType, in.CacheControl)
+	}
+	if in.StorageClass != types.StorageClassStandardIa {
+		t.Errorf("Storage class not preserved, got %q", in.StorageClass)
+	}
+	if in.ServerSideEncryption != types.ServerSideEncryptionAwsKms || aws.ToString(in.SSEKMSKeyId) != "kms-key" {
+		t.Error("Encryption not preserved")
+	}
+	if in.Metadata["key1"] != "value1" || aws.ToString(in.Tagging) != "tag1=value1" {
+		t.Errorf("Metadata or tags not preserved: %v, %v", in.Metadata, in.Tagging)
+	}
+	if aws.ToString(in.GrantRead) != `id="123456"` {
+		t.Errorf("Grants not preserved, got %v", in.GrantRead)
+	}
+	if aws.ToString(client.completeInput.IfMatch) != `"old-etag"` {
+		t.Errorf("Expected conditional completion, got %v", client.completeInput.IfMatch)
+	}
+
+	if aws.ToString(result.NewETag) != `"multipart-etag"` || aws.ToString(result.NewVersionId) != "v2" {
+		t.Errorf("Unexpected result %v/%v", aws.ToString(result.NewETag), aws.ToString(result.NewVersionId))
+	}
+	if result.BytesUploaded != int64(len(content)) {
+		t.Errorf("Expected %d bytes uploaded, got %d", len(content), result.BytesUploaded)
+	}
+}
+
+// Test failed parts are retried and the upload is aborted when retries run out
+func TestOverwrite_MultipartPartFailure(t *testing.T) {
+	largePath, _ := writeLargeFile(t, 11*1024*1024)
+	slowDown := &smithy.GenericAPIError{Code: "SlowDown"}
+	// Back off briefly between part attempts; the upload as a whole is not retried
+	fast := WithRetryPolicy(RetryPolicy{BaseDelay: time.Millisecond}, StagePut)
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return largePath, false, nil
+	}
+
+	t.Run("retry succeeds", func(t *testing.T) {
+		client := newMockClient(mockObject{body: "small"})
+		client.uploadPartFunc = func(input *s3.UploadPartInput, data []byte, attempt int) error {
+			if aws.ToInt32(input.PartNumber) == 2 && attempt == 1 {
+				return slowDown
+			}
+			return nil
+		}
+
+		_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", callback,
+			WithCannedACL("private"), WithMultipartThreshold(1024), WithPartSize(5*1024*1024), fast)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if client.aborted {
+			t.Error("Upload should not be aborted after a successful retry")
+		}
+		if client.partAttempts[2] != 2 {
+			t.Errorf("Expected part 2 to be attempted twice, got %d", client.partAttempts[2])
+		}
+	})
+
+	t.Run("retries exhausted", func(t *testing.T) {
+		client := newMockClient(mockObject{body: "small"})
+		client.uploadPartFunc = func(input *s3.UploadPartInput, data []byte, attempt int) error {
+			if aws.ToInt32(input.PartNumber) == 2 {
+				return slowDown
+			}
+			return nil
+		}
+
+		_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", callback,
+			WithCannedACL("private"), WithMultipartThreshold(1024), WithPartSize(5*1024*1024), WithPartRetries(1), fast)
+
+		if err == nil || !strings.Contains(err.Error(), "failed to upload part 2") {
+			t.Fatalf("Expected part failure, got %v", err)
+		}
+		if client.partAttempts[2] != 2 {
+			t.Errorf("Expected part 2 to be attempted twice, got %d", client.partAttempts[2])
+		}
+		if !client.aborted {
+			t.Error("Expected the multipart upload to be aborted")
+		}
+		if client.completeInput != nil {
+			t.Error("CompleteMultipartUpload should not be called")
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		client := newMockClient(mockObject{body: "small"})
+		client.uploadPartFunc = func(input *s3.UploadPartInput, data []byte, attempt int) error {
+			if aws.ToInt32(input.PartNumber) == 2 {
+				return &smithy.GenericAPIError{Code: "NoSuchUpload"}
+			}
+			return nil
+		}
+
+		_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", callback,
+			WithCannedACL("private"), WithMultipartThreshold(1024), WithPartSize(5*1024*1024), fast)
+
+		if err == nil || client.partAttempts[2] != 1 {
+			t.Errorf("Expected a single attempt of part 2, got %d: %v", client.partAttempts[2], err)
+		}
+	})
+}
+
+// Test clients without multipart support fall back to PutObject
+func TestOverwrite_MultipartFallback(t *testing.T) {
+	putObjectCalled := false
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("test content"))}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putObjectCalled = true
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	_, err := Overwrite(context.Background(), struct{ S3Client }{client}, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"), WithMultipartThreshold(1))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !putObjectCalled {
+		t.Error("Expected PutObject to be used")
+	}
+}
+
+// Test part sizes grow to stay within the part limit
+func TestPartSizeFor(t *testing.T) {
+	tests := []struct {
+		size     int64
+		partSize int64
+		expected int64
+	}{
+		{100, 1, minPartSize},
+		{10 * 1024 * 1024, defaultPartSize, defaultPartSize},
+		{maxParts * minPartSize, minPartSize, minPartSize},
+		{maxParts*minPartSize + 1, minPartSize, 2 * minPartSize},
+	}
+
+	for _, tt := range tests {
+		if got := partSizeFor(tt.size, tt.partSize); got != tt.expected {
+			t.Errorf("partSizeFor(%d, %d) = %d, expected %d", tt.size, tt.partSize, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package overwrite
+
+import (
+	"errors"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrObjectLocked is returned (wrapped) when LockedObjectRefuse is set and the object
+// is under a legal hold or an active retention period
+var ErrObjectLocked = errors.New("object is locked")
+
+// LockedObjectPolicy decides what happens to objects protected by Object Lock
+type LockedObjectPolicy int
+
+const (
+	// LockedObjectOverwrite writes a new version and re-applies the lock to it (the default)
+	LockedObjectOverwrite LockedObjectPolicy = iota
+	// LockedObjectSkip leaves protected objects untouched, as if the callback skipped them
+	LockedObjectSkip
+	// LockedObjectRefuse fails with ErrObjectLocked for protected objects
+	LockedObjectRefuse
+)
+
+// objectLock holds the Object Lock settings of an object version
+type objectLock struct {
+	mode        types.ObjectLockMode
+	retainUntil *time.Time
+	legalHold   types.ObjectLockLegalHoldStatus
+}
+
+// objectLockFromGetObject captures the Object Lock settings reported by GetObject
+func objectLockFromGetObject(getResp *s3.GetObjectOutput) objectLock {
+	return objectLock{
+		mode:        getResp.ObjectLockMode,
+		retainUntil: getResp.ObjectLockRetainUntilDate,
+		legalHold:   getResp.ObjectLockLegalHoldStatus,
+	}
+}
+
+// retentionActive reports whether the retention period has not yet expired
+func (l objectLock) retentionActive(now time.Time) bool {
+	return l.mode != "" && l.retainUntil != nil && l.retainUntil.After(now)
+}
+
+// isProtected reports whether the object is under a legal hold or an active retention.
+// Governance retention does not count when bypassGovernance is set.
+func (l objectLock) isProtected(now time.Time, bypassGovernance bool) bool {
+	if l.legalHold == types.ObjectLockLegalHoldStatusOn {
+		return true
+	}
+	if !l.retentionActive(now) {
+		return false
+	}
+	return l.mode == types.ObjectLockModeCompliance || !bypassGovernance
+}
+
+// addObjectLockToInput re-applies the Object Lock settings to PutObject input.
+// Expired retention periods are dropped because S3 rejects dates in the past.
+func addObjectLockToInput(input interface{}, l objectLock, now time.Time) {
+	switch v := input.(type) {
+	case *s3.PutObjectInput:
+		if l.retentionActive(now) {
+			v.ObjectLockMode = l.mode
+			v.ObjectLockRetainUntilDate = l.retainUntil
+		}
+		if l.legalHold != "" {
+			v.ObjectLockLegalHoldStatus = l.legalHold
+		}
+	}
+}
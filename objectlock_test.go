@@ -0,0 +1,152 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test retention and legal hold are re-applied to the new version
+func TestOverwrite_PreservesObjectLock(t *testing.T) {
+	retainUntil := time.Now().Add(24 * time.Hour)
+	client := newMockClient(mockObject{
+		body:        "test content",
+		lockMode:    types.ObjectLockModeGovernance,
+		retainUntil: &retainUntil,
+		legalHold:   types.ObjectLockLegalHoldStatusOn,
+	})
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusWritten {
+		t.Fatalf("Expected object to be written, got %q", result.Status)
+	}
+	putInput := client.putInputs[0]
+	if putInput.ObjectLockMode != types.ObjectLockModeGovernance {
+		t.Errorf("Expected GOVERNANCE mode, got %q", putInput.ObjectLockMode)
+	}
+	if putInput.ObjectLockRetainUntilDate == nil || !putInput.ObjectLockRetainUntilDate.Equal(retainUntil) {
+		t.Errorf("Expected retain until %v, got %v", retainUntil, putInput.ObjectLockRetainUntilDate)
+	}
+	if putInput.ObjectLockLegalHoldStatus != types.ObjectLockLegalHoldStatusOn {
+		t.Errorf("Expected legal hold ON, got %q", putInput.ObjectLockLegalHoldStatus)
+	}
+}
+
+// Test an expired retention period is not re-applied
+func TestOverwrite_DropsExpiredRetention(t *testing.T) {
+	retainUntil := time.Now().Add(-time.Hour)
+	client := newMockClient(mockObject{
+		body:        "test content",
+		lockMode:    types.ObjectLockModeCompliance,
+		retainUntil: &retainUntil,
+	})
+
+	_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"), WithLockedObjectPolicy(LockedObjectRefuse))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	putInput := client.putInputs[0]
+	if putInput.ObjectLockMode != "" || putInput.ObjectLockRetainUntilDate != nil {
+		t.Errorf("Expired retention should not be re-applied, got %q until %v", putInput.ObjectLockMode, putInput.ObjectLockRetainUntilDate)
+	}
+}
+
+// Test locked objects are skipped or refused according to the policy
+func TestOverwrite_LockedObjectPolicy(t *testing.T) {
+	retainUntil := time.Now().Add(24 * time.Hour)
+
+	tests := []struct {
+		name          string
+		mode          types.ObjectLockMode
+		legalHold     types.ObjectLockLegalHoldStatus
+		opts          []Option
+		expectStatus  OverwriteStatus
+		expectLockErr bool
+	}{
+		{
+			name:         "legal hold is skipped",
+			legalHold:    types.ObjectLockLegalHoldStatusOn,
+			opts:         []Option{WithLockedObjectPolicy(LockedObjectSkip)},
+			expectStatus: StatusSkipped,
+		},
+		{
+			name:          "compliance retention is refused",
+			mode:          types.ObjectLockModeCompliance,
+			opts:          []Option{WithLockedObjectPolicy(LockedObjectRefuse)},
+			expectLockErr: true,
+		},
+		{
+			name:          "compliance retention ignores governance bypass",
+			mode:          types.ObjectLockModeCompliance,
+			opts:          []Option{WithLockedObjectPolicy(LockedObjectRefuse), WithGovernanceBypass()},
+			expectLockErr: true,
+		},
+		{
+			name:         "governance retention is skipped without bypass",
+			mode:         types.ObjectLockModeGovernance,
+			opts:         []Option{WithLockedObjectPolicy(LockedObjectSkip)},
+			expectStatus: StatusSkipped,
+		},
+		{
+			name:         "governance retention is overwritten with bypass",
+			mode:         types.ObjectLockModeGovernance,
+			opts:         []Option{WithLockedObjectPolicy(LockedObjectRefuse), WithGovernanceBypass()},
+			expectStatus: StatusWritten,
+		},
+		{
+			name:         "legal hold OFF is overwritten",
+			legalHold:    types.ObjectLockLegalHoldStatusOff,
+			opts:         []Option{WithLockedObjectPolicy(LockedObjectRefuse)},
+			expectStatus: StatusWritten,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			object := mockObject{body: "test content", lockMode: tt.mode, legalHold: tt.legalHold}
+			if tt.mode != "" {
+				object.retainUntil = aws.Time(retainUntil)
+			}
+			client := newMockClient(object)
+
+			callbackCalled := false
+			opts := append([]Option{WithCannedACL("private")}, tt.opts...)
+			result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+				callbackCalled = true
+				return srcFilePath, false, nil
+			}, opts...)
+
+			if tt.expectLockErr {
+				if !errors.Is(err, ErrObjectLocked) {
+					t.Fatalf("Expected ErrObjectLocked, got %v", err)
+				}
+				if callbackCalled || len(client.putInputs) != 0 {
+					t.Error("Locked object should not reach the callback or PutObject")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Status != tt.expectStatus {
+				t.Errorf("Expected status %q, got %q", tt.expectStatus, result.Status)
+			}
+			if tt.expectStatus == StatusSkipped && callbackCalled {
+				t.Error("Callback should not be called for a skipped locked object")
+			}
+		})
+	}
+}
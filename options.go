@@ -0,0 +1,328 @@
+package overwrite
+
+// Option configures an overwrite operation
+type Option func(*options)
+
+// options holds the settings collected from Option values
+type options struct {
+	cannedACL          string
+	tempDir            string
+	conditionalWrite   bool
+	concurrencyRetries int
+	customerKey        SSECustomerKeyProvider
+	kmsContext         *string
+	lockedObjects      LockedObjectPolicy
+	bypassGovernance   bool
+	decide             DecideFunc
+	stamp              string
+	backup             *BackupLocation
+	journal            Journal
+	dryRun             bool
+	planner            Planner
+	verify             bool
+	skipUnchanged      bool
+	retries            map[Stage]RetryPolicy
+	aclFailure         ACLFailurePolicy
+
+	multipartThreshold   int64
+	partSize             int64
+	multipartConcurrency int
+	partRetries          int
+
+	workers     int
+	maxFailures int
+	filter      *Filter
+	checkpoint  string
+}
+
+// newOptions applies opts on top of the defaults
+func newOptions(opts []Option) *options {
+	o := &options{
+		multipartThreshold:   defaultMultipartThreshold,
+		partSize:             defaultPartSize,
+		multipartConcurrency: defaultMultipartConcurrency,
+		partRetries:          defaultPartRetries,
+		workers:              defaultWorkers,
+	}
+	for _, opt := range opts {
+		if opt != nil {
+			opt(o)
+		}
+	}
+	return o
+}
+
+// WithPreservedACL keeps the object's existing ACL grants (the default).
+// It undoes an earlier WithCannedACL.
+func WithPreservedACL() Option {
+	return func(o *options) {
+		o.cannedACL = ""
+	}
+}
+
+// WithCannedACL replaces the object's ACL with a simple ACL such as "private" or "public-read".
+// GetObjectAcl is not called in this mode.
+func WithCannedACL(acl string) Option {
+	return func(o *options) {
+		o.cannedACL = acl
+	}
+}
+
+// WithTempDir sets the directory for the downloaded temp file.
+// The default is os.TempDir.
+func WithTempDir(dir string) Option {
+	return func(o *options) {
+		o.tempDir = dir
+	}
+}
+
+// WithConditionalWrite makes the upload conditional on the ETag returned by GetObject.
+// If another writer replaces the object while the callback runs, the upload is refused
+// and the overwrite returns an error wrapping ErrConcurrentModification.
+func WithConditionalWrite() Option {
+	return func(o *options) {
+		o.conditionalWrite = true
+	}
+}
+
+// WithConcurrencyRetries restarts the whole overwrite (download, callback and upload)
+// up to n more times when the object was modified concurrently.
+// It implies WithConditionalWrite.
+func WithConcurrencyRetries(n int) Option {
+	return func(o *options) {
+		o.conditionalWrite = true
+		if n < 0 {
+			n = 0
+		}
+		o.concurrencyRetries = n
+	}
+}
+
+// WithSSECustomerKey supplies the customer key for SSE-C encrypted objects.
+// The key is sent with GetObject and the new object is encrypted with it.
+func WithSSECustomerKey(provider SSECustomerKeyProvider) Option {
+	return func(o *options) {
+		o.customerKey = provider
+	}
+}
+
+// WithSSEKMSEncryptionContext sets the base64-encoded JSON encryption context for SSE-KMS objects.
+// S3 does not return the context on GetObject, so it cannot be carried over automatically.
+func WithSSEKMSEncryptionContext(encryptionContext string) Option {
+	return func(o *options) {
+		o.kmsContext = &encryptionContext
+	}
+}
+
+// WithLockedObjectPolicy decides what happens to objects under a legal hold or an active
+// retention period. By default they are overwritten and the lock is re-applied to the new version.
+func WithLockedObjectPolicy(policy LockedObjectPolicy) Option {
+	return func(o *options) {
+		o.lockedObjects = policy
+	}
+}
+
+// WithGovernanceBypass lets LockedObjectSkip and LockedObjectRefuse treat objects under
+// GOVERNANCE retention as overwritable. Legal holds and COMPLIANCE retention still apply.
+func WithGovernanceBypass() Option {
+	return func(o *options) {
+		o.bypassGovernance = true
+	}
+}
+
+// WithMultipartThreshold sets the size above which the new object is uploaded with a
+// multipart upload instead of PutObject. The default is 5 GiB, the PutObject limit.
+// The client must implement MultipartClient; otherwise PutObject is always used.
+func WithMultipartThreshold(bytes int64) Option {
+	return func(o *options) {
+		o.multipartThreshold = bytes
+	}
+}
+
+// WithPartSize sets the multipart part size (default 64 MiB, minimum 5 MiB).
+// It is increased automatically when the object would need more than 10,000 parts.
+func WithPartSize(bytes int64) Option {
+	return func(o *options) {
+		o.partSize = bytes
+	}
+}
+
+// WithMultipartConcurrency sets how many parts are uploaded in parallel (default 4)
+func WithMultipartConcurrency(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			n = 1
+		}
+		o.multipartConcurrency = n
+	}
+}
+
+// WithPartRetries sets how many more times a failed part is retried (default 2). Parts
+// are retried with the delays and retryable errors of the StagePut retry policy, or of
+// DefaultRetryPolicy when none is set.
+func WithPartRetries(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			n = 0
+		}
+		o.partRetries = n
+	}
+}
+
+// decides reports whether objects are checked before they are downloaded
+func (o *options) decides() bool {
+	return o.decide != nil || o.stamp != ""
+}
+
+// WithDecide sets a hook that decides from the object's attributes whether to process it.
+// With a client implementing HeadClient it runs against HeadObject, before GetObject, so
+// skipped objects are never downloaded. Otherwise it runs on the GetObject response
+// before the body is read.
+func WithDecide(decide DecideFunc) Option {
+	return func(o *options) {
+		o.decide = decide
+	}
+}
+
+// WithWorkers sets how many objects OverwritePrefix processes in parallel (default 4)
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		if n < 1 {
+			n = 1
+		}
+		o.workers = n
+	}
+}
+
+// WithMaxFailures stops OverwritePrefix once n objects have failed.
+// Zero (the default) means the batch never stops because of failures.
+func WithMaxFailures(n int) Option {
+	return func(o *options) {
+		if n < 0 {
+			n = 0
+		}
+		o.maxFailures = n
+	}
+}
+
+// WithFilter restricts OverwritePrefix to the objects matching f
+func WithFilter(f Filter) Option {
+	return func(o *options) {
+		o.filter = &f
+	}
+}
+
+// WithCheckpoint makes OverwritePrefix resumable. Progress is saved to path at most once
+// a second and when the batch stops, and a later run with the same path, bucket and
+// prefix resumes from it without processing finished objects again. Objects that failed
+// are processed first; objects that were in flight, or finished within the last second,
+// when the process died are processed again. The file is removed once the batch
+// finishes without failures. WithCheckpoint cannot be combined with WithDryRun.
+func WithCheckpoint(path string) Option {
+	return func(o *options) {
+		o.checkpoint = path
+	}
+}
+
+// WithTransformStamp writes "name@version" to the overwrite-transform metadata key of
+// every overwritten object, and skips objects that already carry it. Like WithDecide,
+// the check runs against HeadObject when the client supports it. Bumping the version
+// makes the transform apply again.
+func WithTransformStamp(name, version string) Option {
+	return func(o *options) {
+		o.stamp = name + "@" + version
+	}
+}
+
+// WithBackup copies the original object to loc, with its metadata, tags and ACL,
+// before it is overwritten. The copy is server-side and requires a client implementing
+// CopyClient. Use Restore to put a backup back.
+func WithBackup(loc BackupLocation) Option {
+	return func(o *options) {
+		o.backup = &loc
+	}
+}
+
+// WithJournal records the previous and new version of every object written in j,
+// so that Rollback can undo the overwrites in a versioned bucket. An error recording
+// the entry is returned after the object has been written.
+func WithJournal(j Journal) Option {
+	return func(o *options) {
+		o.journal = j
+	}
+}
+
+// WithDryRun runs the download and the callback but writes nothing. Instead, the
+// result's Status is StatusPlanned (or StatusSkipped) and its Plan describes the
+// sizes, SHA-256 digests, metadata, header and tag changes and the ACL that the
+// overwrite would apply. The plan is also passed to planner unless it is nil.
+func WithDryRun(planner Planner) Option {
+	return func(o *options) {
+		o.dryRun = true
+		o.planner = planner
+	}
+}
+
+// WithVerify re-reads the written object with HeadObject, GetObjectTagging and
+// GetObjectAcl and compares its metadata, headers, tags and grants with what was
+// written. Differences are returned as a *VerificationError wrapping
+// ErrVerificationFailed. The client must implement HeadClient.
+func WithVerify() Option {
+	return func(o *options) {
+		o.verify = true
+	}
+}
+
+// WithSkipUnchanged skips the upload when the callback's output has the same SHA-256
+// as the original body and the metadata, headers, tags and ACL were left as they were,
+// so no new version is created. The result's Status is then StatusUnchanged.
+// OverwriteMetadata only compares the attributes; OverwriteStream only compares output
+// that fits in one part (WithPartSize), because larger output is uploaded as it is written.
+func WithSkipUnchanged() Option {
+	return func(o *options) {
+		o.skipUnchanged = true
+	}
+}
+
+// WithACLRetries sets how many more times PutObjectAcl is retried, on any error, when
+// restoring WRITE grants after the upload succeeds (default 0). It is a shorthand for a
+// StagePutACL retry policy without delay.
+func WithACLRetries(n int) Option {
+	return func(o *options) {
+		o.setRetryPolicy(RetryPolicy{MaxAttempts: n + 1, Retryable: func(error) bool { return true }}, StagePutACL)
+	}
+}
+
+// WithRetryPolicy retries the S3 calls of the given stages under policy: StageDownload
+// (HeadObject, GetObject and reading the body, which is fetched again for the same
+// version), StageGetTagging, StageGetACL, StagePut (PutObject, CopyObject or the
+// multipart upload) and StagePutACL. Reads made by WithVerify use the same policies. Without stages, policy applies to all five. An upload is retried from
+// the callback's output file, without running the callback again; OverwriteStream cannot
+// replay its callback's output, so its upload is not retried.
+func WithRetryPolicy(policy RetryPolicy, stages ...Stage) Option {
+	return func(o *options) {
+		if len(stages) == 0 {
+			stages = retriedStages
+		}
+		o.setRetryPolicy(policy, stages...)
+	}
+}
+
+// setRetryPolicy sets the retry policy of stages
+func (o *options) setRetryPolicy(policy RetryPolicy, stages ...Stage) {
+	if o.retries == nil {
+		o.retries = map[Stage]RetryPolicy{}
+	}
+	for _, stage := range stages {
+		o.retries[stage] = policy
+	}
+}
+
+// WithACLFailurePolicy decides how to compensate when WRITE grants cannot be restored
+// after the object was written. The error is returned either way, and
+// OverwriteResult.ACLCompensation reports the outcome.
+func WithACLFailurePolicy(policy ACLFailurePolicy) Option {
+	return func(o *options) {
+		o.aclFailure = policy
+	}
+}
@@ -2,8 +2,10 @@ package overwrite
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
 	"strings"
@@ -14,11 +16,16 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 )
 
+// ErrConcurrentModification is returned (wrapped) when a conditional upload is refused
+// because the object was changed by another writer after it was downloaded
+var ErrConcurrentModification = errors.New("object was modified concurrently")
+
 // ObjectInfo contains S3 object metadata
+// Changes the callback makes to Metadata, Headers, Tags and ACL are applied to the new object.
 type ObjectInfo struct {
 	Bucket        string
 	Key           string
-	ContentType   *string
+	ContentType   *string // same value as Headers.ContentType; change Headers to replace it
 	ContentLength *int64
 	ETag          *string
 	LastModified  *time.Time
@@ -26,6 +33,20 @@ type ObjectInfo struct {
 	StorageClass  *string
 	TagCount      *int64
 	VersionId     *string
+	Headers       *ObjectHeaders
+	Tags          map[string]string
+	ACL           *ObjectACL // nil when a simple ACL replaces the object's ACL
+}
+
+// ObjectHeaders contains the HTTP headers preserved on overwrite
+type ObjectHeaders struct {
+	ContentType             *string
+	CacheControl            *string
+	ContentDisposition      *string
+	ContentEncoding         *string
+	ContentLanguage         *string
+	Expires                 *time.Time
+	WebsiteRedirectLocation *string
 }
 
 // OverwriteCallback defines the callback function signature
@@ -45,6 +66,22 @@ type S3Client interface {
 	PutObjectAcl(ctx context.Context, params *s3.PutObjectAclInput, optFns ...func(*s3.Options)) (*s3.PutObjectAclOutput, error)
 }
 
+// Overwrite overwrites an S3 object while preserving its metadata and tags.
+// The existing ACL is preserved unless WithCannedACL is given.
+func Overwrite(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	callback OverwriteCallback,
+	opts ...Option,
+) (*OverwriteResult, error) {
+	o := newOptions(opts)
+	return retryOnConcurrentModification(bucket, key, o, func(result *OverwriteResult) error {
+		return overwrite(ctx, client, bucket, key, callback, o, result)
+	})
+}
+
 // OverwriteS3Object overwrites an S3 object while preserving its existing ACL
 func OverwriteS3Object(
 	ctx context.Context,
@@ -52,61 +89,113 @@ func OverwriteS3Object(
 	bucket string,
 	key string,
 	callback OverwriteCallback,
+	opts ...Option,
+) (*OverwriteResult, error) {
+	return Overwrite(ctx, client, bucket, key, callback, opts...)
+}
+
+// OverwriteS3ObjectWithAcl overwrites an S3 object with a specific simple ACL
+func OverwriteS3ObjectWithAcl(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	acl string,
+	callback OverwriteCallback,
+	opts ...Option,
+) (*OverwriteResult, error) {
+	opts = append(opts[:len(opts):len(opts)], WithCannedACL(acl))
+	return Overwrite(ctx, client, bucket, key, callback, opts...)
+}
+
+// overwrite performs a single overwrite attempt
+func overwrite(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	callback OverwriteCallback,
+	o *options,
+	result *OverwriteResult,
 ) error {
 	// Download object
-	getResp, err := client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
+	downloadStart := time.Now()
+	if skip, err := decideBeforeGet(ctx, client, bucket, key, o, result); skip || err != nil {
+		return err
+	}
+	src, err := getSource(ctx, client, bucket, key, o, result)
 	if err != nil {
-		return fmt.Errorf("failed to get object: %w", err)
+		return err
 	}
+	getResp := src.getResp
 	defer func() {
 		_ = getResp.Body.Close()
 	}()
+	if skip, err := decideAfterGet(client, bucket, key, getResp, o, result); skip || err != nil {
+		return err
+	}
+
+	// Check Object Lock before spending time on the body
+	if skip, err := checkObjectLock(src, o, result); skip || err != nil {
+		return err
+	}
 
 	// Create temporary file
-	tmpFile, err := os.CreateTemp("", "s3-overwrite-*.tmp")
+	tmpFile, err := os.CreateTemp(o.tempDir, "s3-overwrite-*.tmp")
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return stageError(StageDownload, fmt.Errorf("failed to create temp file: %w", err))
 	}
 	defer func() {
 		_ = tmpFile.Close()
 		_ = os.Remove(tmpFile.Name())
 	}()
 
-
 	// Copy object content to temp file
-	if _, err := io.Copy(tmpFile, getResp.Body); err != nil {
-		return fmt.Errorf("failed to copy object content: %w", err)
+	downloaded, err := downloadBody(ctx, client, bucket, key, src, tmpFile, o)
+	if err != nil {
+		return stageError(StageDownload, err)
+	}
+	result.BytesDownloaded = downloaded
+	// Hash the original before the callback can edit the temp file in place
+	var oldSum string
+	if o.skipUnchanged || o.dryRun {
+		if _, oldSum, err = hashFile(tmpFile.Name()); err != nil {
+			return stageError(StageDownload, fmt.Errorf("failed to hash temp file: %w", err))
+		}
 	}
+	result.Timings.Download = time.Since(downloadStart)
 
 	// Seek to beginning for callback
 	if _, err := tmpFile.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to seek temp file: %w", err)
+		return stageError(StageDownload, fmt.Errorf("failed to seek temp file: %w", err))
 	}
 
-	// Build ObjectInfo
-	info := ObjectInfo{
-		Bucket:        bucket,
-		Key:           key,
-		ContentType:   getResp.ContentType,
-		ContentLength: getResp.ContentLength,
-		ETag:          getResp.ETag,
-		LastModified:  getResp.LastModified,
-		Metadata:      convertMetadataToPointers(getResp.Metadata),
-		StorageClass:  aws.String(string(getResp.StorageClass)),
-		TagCount:      aws.Int64(int64(aws.ToInt32(getResp.TagCount))),
-		VersionId:     getResp.VersionId,
+	// Get existing tags and ACL so the callback can edit them
+	attributesStart := time.Now()
+	tags, err := getTags(ctx, client, bucket, key, getResp, o)
+	if err != nil {
+		return err
+	}
+	acl, err := getACL(ctx, client, bucket, key, nil, o)
+	if err != nil {
+		return err
 	}
+	src.acl = acl.clone()
+	result.Timings.Attributes = time.Since(attributesStart)
+
+	// Build ObjectInfo
+	info := newObjectInfo(bucket, key, getResp, tags, acl)
 
 	// Call callback with temp file path
+	callbackStart := time.Now()
 	overwritingFilePath, autoRemove, err := callback(info, tmpFile.Name())
+	result.Timings.Callback = time.Since(callbackStart)
 	if err != nil {
-		return fmt.Errorf("callback error: %w", err)
+		return stageError(StageCallback, fmt.Errorf("callback error: %w", err))
 	}
 
 	if overwritingFilePath == "" {
+		result.Status = StatusSkipped
 		return nil
 	}
 
@@ -117,201 +206,477 @@ func OverwriteS3Object(
 		}()
 	}
 
-	// Get existing tags
-	var tagging *string
-	if getResp.TagCount != nil && *getResp.TagCount > 0 {
-		tagResp, err := client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
-		})
-		if err != nil {
-			return fmt.Errorf("failed to get object tagging: %w", err)
-		}
+	return writeObject(ctx, client, bucket, key, src, info, tags, callbackOutput{
+		unchanged: func() (bool, error) {
+			same, err := contentUnchanged(overwritingFilePath, downloaded, oldSum)
+			return same, stageError(StageDecide, err)
+		},
+		plan: func(plan *PlanEntry) (bool, error) {
+			return false, stageError(StageRecord, planFiles(plan, downloaded, oldSum, overwritingFilePath))
+		},
+		write: func(putInput *s3.PutObjectInput) (bool, error) {
+			uploadFile, err := os.Open(overwritingFilePath)
+			if err != nil {
+				return false, stageError(StagePut, fmt.Errorf("failed to open overwriting file: %w", err))
+			}
+			defer uploadFile.Close()
+
+			// Put object, retrying from the same file
+			err = retryStage(ctx, o, StagePut, func(int) error {
+				return uploadObject(ctx, client, putInput, uploadFile, o, result)
+			})
+			if err != nil {
+				return false, putObjectError(err, o)
+			}
+			return false, nil
+		},
+	}, o, result)
+}
 
-		if len(tagResp.TagSet) > 0 {
-			tagStr := buildTaggingString(tagResp.TagSet)
-			tagging = &tagStr
-		}
-	}
+// callbackOutput is how an entry point hands the callback's output to writeObject.
+// Each function returns errors with their stage, and plan and write report whether
+// the object turned out to be skipped, with result.Status already set.
+type callbackOutput struct {
+	unchanged func() (bool, error)                            // whether the body equals the original
+	plan      func(plan *PlanEntry) (bool, error)             // fills in the sizes and digests of a dry run
+	write     func(putInput *s3.PutObjectInput) (bool, error) // uploads or copies the new object
+}
 
-	// Get existing ACL
-	aclResp, err := client.GetObjectAcl(ctx, &s3.GetObjectAclInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
+// writeObject is what every entry point does after its callback: it validates the tags
+// and grants the callback left, leaves an unchanged object alone, describes the change
+// in a dry run, keeps a backup, writes the object with out.write and finally restores
+// WRITE grants and verifies the result
+func writeObject(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	src *source,
+	info ObjectInfo,
+	oldTags []types.Tag,
+	out callbackOutput,
+	o *options,
+	result *OverwriteResult,
+) error {
+	// Validate the tags and grants the callback left
+	tags, err := tagsFromMap(info.Tags)
 	if err != nil {
-		return fmt.Errorf("failed to get object ACL: %w", err)
+		return stageError(StageCallback, err)
 	}
-
-	// Open the file to upload
-	uploadFile, err := os.Open(overwritingFilePath)
+	grants, err := info.ACL.s3Grants()
 	if err != nil {
-		return fmt.Errorf("failed to open overwriting file: %w", err)
+		return stageError(StageCallback, err)
 	}
-	defer uploadFile.Close()
 
-	// Build PutObject input
-	putInput := &s3.PutObjectInput{
-		Bucket:                  aws.String(bucket),
-		Key:                     aws.String(key),
-		Body:                    uploadFile,
-		ContentType:             getResp.ContentType,
-		CacheControl:            getResp.CacheControl,
-		ContentDisposition:      getResp.ContentDisposition,
-		ContentEncoding:         getResp.ContentEncoding,
-		ContentLanguage:         getResp.ContentLanguage,
-		WebsiteRedirectLocation: getResp.WebsiteRedirectLocation,
-		StorageClass:            getResp.StorageClass,
-		Metadata:                convertMetadataFromPointers(info.Metadata), // Use metadata from callback-modified info
-		Tagging:                 tagging,
+	// Leave the object alone if the callback changed nothing
+	if o.skipUnchanged && attributesUnchanged(src, oldTags, info, grants, o) {
+		same, err := out.unchanged()
+		if err != nil {
+			return err
+		}
+		if same {
+			result.Status = StatusUnchanged
+			return nil
+		}
 	}
 
-	// Add grant parameters (except WRITE)
-	addGrantsToInput(putInput, aclResp.Grants, false)
+	// Describe the change instead of writing it
+	if o.dryRun {
+		putInput := buildPutInput(bucket, key, src, info, tags, grants, o, result)
+		plan := newPlanEntry(bucket, key, src.getResp, oldTags, putInput, info.ACL)
+		if skip, err := out.plan(plan); skip || err != nil {
+			return err
+		}
+		result.Plan = plan
+		result.Status = StatusPlanned
+		return nil
+	}
+
+	// Keep a copy of the original before it is replaced
+	if o.backup != nil {
+		if err := backupObject(ctx, client, bucket, key, src, o, result); err != nil {
+			return err
+		}
+	}
 
-	// Put object
-	if _, err := client.PutObject(ctx, putInput); err != nil {
-		return fmt.Errorf("failed to put object: %w", err)
+	// Write the object
+	putInput := buildPutInput(bucket, key, src, info, tags, grants, o, result)
+	uploadStart := time.Now()
+	skip, err := out.write(putInput)
+	result.Timings.Upload = time.Since(uploadStart)
+	if skip || err != nil {
+		return err
 	}
+	result.Status = StatusWritten
 
 	// Check if we need to restore WRITE permissions
-	if hasWriteGrant(aclResp.Grants) {
-		aclInput := &s3.PutObjectAclInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
-		}
-		addGrantsToInput(aclInput, aclResp.Grants, true)
+	if err := finishACL(ctx, client, bucket, key, src, grants, o, result); err != nil {
+		return err
+	}
+	return verifyWrite(ctx, client, bucket, key, putInput, grants, o, result)
+}
 
-		if _, err := client.PutObjectAcl(ctx, aclInput); err != nil {
-			return fmt.Errorf("failed to put object ACL: %w", err)
+// downloadBody copies the object's body to file, checking it against its length and
+// checksum. A failed copy is retried under the download retry policy from a new
+// GetObject for the same version.
+func downloadBody(ctx context.Context, client S3Client, bucket, key string, src *source, file *os.File, o *options) (int64, error) {
+	var n int64
+	err := retryStage(ctx, o, StageDownload, func(attempt int) error {
+		if attempt > 1 {
+			if err := reopenSource(ctx, client, bucket, key, src); err != nil {
+				return err
+			}
+			if _, err := file.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to seek temp file: %w", err)
+			}
+			if err := file.Truncate(0); err != nil {
+				return fmt.Errorf("failed to truncate temp file: %w", err)
+			}
 		}
-	}
+		var err error
+		if n, err = io.Copy(file, newVerifiedBody(src.getResp)); err != nil {
+			return fmt.Errorf("failed to copy object content: %w", err)
+		}
+		return nil
+	})
+	return n, err
+}
 
+// reopenSource replaces the body of src with a new GetObject of the same version.
+// A refused request means the object was replaced in the meantime.
+func reopenSource(ctx context.Context, client S3Client, bucket, key string, src *source) error {
+	getInput := &s3.GetObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		IfMatch:      src.getResp.ETag,
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	if v := aws.ToString(src.getResp.VersionId); v != "" && v != "null" {
+		getInput.VersionId = src.getResp.VersionId
+	}
+	addEncryptionToInput(getInput, encryption{customerKey: src.customerKey})
+	getResp, err := client.GetObject(ctx, getInput)
+	if IsPreconditionFailed(err) {
+		return fmt.Errorf("failed to get object: %w: %w", ErrConcurrentModification, err)
+	} else if err != nil {
+		return fmt.Errorf("failed to get object: %w", err)
+	}
+	_ = src.getResp.Body.Close()
+	src.getResp.Body = getResp.Body
 	return nil
 }
 
-// OverwriteS3ObjectWithAcl overwrites an S3 object with a specific simple ACL
-func OverwriteS3ObjectWithAcl(
-	ctx context.Context,
-	client S3Client,
-	bucket string,
-	key string,
-	acl string,
-	callback OverwriteCallback,
-) error {
-	// Download object
-	getResp, err := client.GetObject(ctx, &s3.GetObjectInput{
-		Bucket: aws.String(bucket),
-		Key:    aws.String(key),
-	})
+// source is the object as returned by GetObject
+type source struct {
+	getResp     *s3.GetObjectOutput
+	customerKey *SSECustomerKey
+	lock        objectLock
+	acl         *ObjectACL // as read, before the callback
+}
+
+// getSource calls GetObject, sending the SSE-C key if one is configured.
+// The caller must close the body.
+func getSource(ctx context.Context, client S3Client, bucket, key string, o *options, result *OverwriteResult) (*source, error) {
+	customerKey, err := lookupCustomerKey(bucket, key, o)
 	if err != nil {
-		return fmt.Errorf("failed to get object: %w", err)
+		return nil, stageError(StageDownload, err)
 	}
-	defer func() {
-		_ = getResp.Body.Close()
-	}()
 
-	// Create temporary file
-	tmpFile, err := os.CreateTemp("", "s3-overwrite-*.tmp")
+	getInput := &s3.GetObjectInput{
+		Bucket:       aws.String(bucket),
+		Key:          aws.String(key),
+		ChecksumMode: types.ChecksumModeEnabled,
+	}
+	addEncryptionToInput(getInput, encryption{customerKey: customerKey})
+	var getResp *s3.GetObjectOutput
+	err = retryStage(ctx, o, StageDownload, func(int) error {
+		getResp, err = client.GetObject(ctx, getInput)
+		return err
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create temp file: %w", err)
+		return nil, stageError(StageDownload, fmt.Errorf("failed to get object: %w", err))
 	}
-	defer func() {
-		_ = tmpFile.Close()
-		_ = os.Remove(tmpFile.Name())
-	}()
+	result.OldETag = getResp.ETag
+	result.OldVersionId = getResp.VersionId
 
+	return &source{
+		getResp:     getResp,
+		customerKey: customerKey,
+		lock:        objectLockFromGetObject(getResp),
+	}, nil
+}
 
-	// Copy object content to temp file
-	if _, err := io.Copy(tmpFile, getResp.Body); err != nil {
-		return fmt.Errorf("failed to copy object content: %w", err)
+// lookupCustomerKey returns the SSE-C key for the object, if one is configured
+func lookupCustomerKey(bucket, key string, o *options) (*SSECustomerKey, error) {
+	if o.customerKey == nil {
+		return nil, nil
+	}
+	customerKey, err := o.customerKey(bucket, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get customer key: %w", err)
 	}
+	return customerKey, nil
+}
 
-	// Seek to beginning for callback
-	if _, err := tmpFile.Seek(0, 0); err != nil {
-		return fmt.Errorf("failed to seek temp file: %w", err)
+// checkObjectLock applies the locked object policy. It reports whether the object must be skipped.
+func checkObjectLock(src *source, o *options, result *OverwriteResult) (bool, error) {
+	if o.lockedObjects == LockedObjectOverwrite || !src.lock.isProtected(time.Now(), o.bypassGovernance) {
+		return false, nil
+	}
+	if o.lockedObjects == LockedObjectRefuse {
+		return true, stageError(StageDecide, fmt.Errorf("refusing to overwrite object: %w", ErrObjectLocked))
 	}
+	result.Status = StatusSkipped
+	return true, nil
+}
 
-	// Build ObjectInfo
-	info := ObjectInfo{
+// newObjectInfo builds the ObjectInfo passed to callbacks
+func newObjectInfo(bucket, key string, getResp *s3.GetObjectOutput, tags []types.Tag, acl *ObjectACL) ObjectInfo {
+	headers := newObjectHeaders(getResp)
+
+	// Always hand out a map so the callback can add metadata
+	metadata := convertMetadataToPointers(getResp.Metadata)
+	if metadata == nil {
+		metadata = make(map[string]*string)
+	}
+
+	return ObjectInfo{
 		Bucket:        bucket,
 		Key:           key,
-		ContentType:   getResp.ContentType,
+		ContentType:   headers.ContentType,
 		ContentLength: getResp.ContentLength,
 		ETag:          getResp.ETag,
 		LastModified:  getResp.LastModified,
-		Metadata:      convertMetadataToPointers(getResp.Metadata),
+		Metadata:      metadata,
 		StorageClass:  aws.String(string(getResp.StorageClass)),
 		TagCount:      aws.Int64(int64(aws.ToInt32(getResp.TagCount))),
 		VersionId:     getResp.VersionId,
+		Headers:       headers,
+		Tags:          tagsToMap(tags),
+		ACL:           acl,
 	}
+}
 
-	// Call callback with temp file path
-	overwritingFilePath, autoRemove, err := callback(info, tmpFile.Name())
-	if err != nil {
-		return fmt.Errorf("callback error: %w", err)
+// newObjectHeaders copies the preserved HTTP headers of a GetObject response
+func newObjectHeaders(getResp *s3.GetObjectOutput) *ObjectHeaders {
+	return &ObjectHeaders{
+		ContentType:             copyString(getResp.ContentType),
+		CacheControl:            copyString(getResp.CacheControl),
+		ContentDisposition:      copyString(getResp.ContentDisposition),
+		ContentEncoding:         copyString(getResp.ContentEncoding),
+		ContentLanguage:         copyString(getResp.ContentLanguage),
+		Expires:                 parseExpires(getResp.ExpiresString),
+		WebsiteRedirectLocation: copyString(getResp.WebsiteRedirectLocation),
 	}
+}
 
-	if overwritingFilePath == "" {
-		return nil
+// getTags fetches the object's tags if GetObject reported any
+func getTags(ctx context.Context, client S3Client, bucket, key string, getResp *s3.GetObjectOutput, o *options) ([]types.Tag, error) {
+	if getResp.TagCount == nil || *getResp.TagCount == 0 {
+		return nil, nil
 	}
+	return fetchTags(ctx, client, bucket, key, nil, o)
+}
 
-	// Schedule cleanup if requested
-	if autoRemove && overwritingFilePath != "" && overwritingFilePath != tmpFile.Name() {
-		defer func() {
-			_ = os.Remove(overwritingFilePath)
-		}()
+// fetchTags calls GetObjectTagging for the given version, or the current one if versionID is nil
+func fetchTags(ctx context.Context, client S3Client, bucket, key string, versionID *string, o *options) ([]types.Tag, error) {
+	var tagResp *s3.GetObjectTaggingOutput
+	err := retryStage(ctx, o, StageGetTagging, func(int) error {
+		var err error
+		tagResp, err = client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
+			Bucket:    aws.String(bucket),
+			Key:       aws.String(key),
+			VersionId: versionID,
+		})
+		return err
+	})
+	if err != nil {
+		return nil, stageError(StageGetTagging, fmt.Errorf("failed to get object tagging: %w", err))
 	}
+	return tagResp.TagSet, nil
+}
 
-	// Get existing tags
-	var tagging *string
-	if getResp.TagCount != nil && *getResp.TagCount > 0 {
-		tagResp, err := client.GetObjectTagging(ctx, &s3.GetObjectTaggingInput{
-			Bucket: aws.String(bucket),
-			Key:    aws.String(key),
+// getACL fetches the ACL of the given version, or the current one if versionID is nil,
+// unless a simple ACL replaces it
+func getACL(ctx context.Context, client S3Client, bucket, key string, versionID *string, o *options) (*ObjectACL, error) {
+	if o.cannedACL != "" {
+		return nil, nil
+	}
+	var aclResp *s3.GetObjectAclOutput
+	err := retryStage(ctx, o, StageGetACL, func(int) error {
+		var err error
+		aclResp, err = client.GetObjectAcl(ctx, &s3.GetObjectAclInput{
+			Bucket:    aws.String(bucket),
+			Key:       aws.String(key),
+			VersionId: versionID,
 		})
-		if err != nil {
-			return fmt.Errorf("failed to get object tagging: %w", err)
-		}
+		return err
+	})
+	if err != nil {
+		return nil, stageError(StageGetACL, fmt.Errorf("failed to get object ACL: %w", err))
+	}
+	return newObjectACL(aclResp.Owner, aclResp.Grants), nil
+}
 
-		if len(tagResp.TagSet) > 0 {
-			tagStr := buildTaggingString(tagResp.TagSet)
-			tagging = &tagStr
-		}
+// buildPutInput builds the PutObject input that recreates the object with its
+// preserved attributes. The body is set by the caller.
+func buildPutInput(
+	bucket string,
+	key string,
+	src *source,
+	info ObjectInfo,
+	tags []types.Tag,
+	grants []types.Grant,
+	o *options,
+	result *OverwriteResult,
+) *s3.PutObjectInput {
+	getResp := src.getResp
+	putInput := &s3.PutObjectInput{
+		Bucket:            aws.String(bucket),
+		Key:               aws.String(key),
+		StorageClass:      getResp.StorageClass,
+		ChecksumAlgorithm: uploadChecksumAlgorithm(checksumFromGetObject(getResp)),
+		Metadata:          addStampToMetadata(convertMetadataFromPointers(info.Metadata), o), // Use metadata from callback-modified info
+	}
+
+	// Use headers from callback-modified info
+	if info.Headers != nil {
+		putInput.ContentType = info.Headers.ContentType
+		putInput.CacheControl = info.Headers.CacheControl
+		putInput.ContentDisposition = info.Headers.ContentDisposition
+		putInput.ContentEncoding = info.Headers.ContentEncoding
+		putInput.ContentLanguage = info.Headers.ContentLanguage
+		putInput.Expires = info.Headers.Expires
+		putInput.WebsiteRedirectLocation = info.Headers.WebsiteRedirectLocation
+	}
+
+	// Keep the object's tags
+	if len(tags) > 0 {
+		putInput.Tagging = aws.String(buildTaggingString(tags))
+		result.Tags = tags
+	}
+
+	// Keep the object's retention and legal hold
+	addObjectLockToInput(putInput, src.lock, time.Now())
+
+	// Keep the object's server-side encryption
+	addEncryptionToInput(putInput, encryptionFromGetObject(getResp, src.customerKey, o.kmsContext))
+
+	if o.cannedACL != "" {
+		// Apply the simple ACL
+		putInput.ACL = types.ObjectCannedACL(o.cannedACL)
+		result.CannedACL = o.cannedACL
+	} else {
+		// Add grant parameters (except WRITE)
+		addGrantsToInput(putInput, grants, false)
+		result.Grants = grants
+	}
+
+	// Only replace the version we downloaded
+	if o.conditionalWrite {
+		putInput.IfMatch = getResp.ETag
 	}
 
-	// Open the file to upload
-	uploadFile, err := os.Open(overwritingFilePath)
+	return putInput
+}
+
+// putObjectError wraps an upload error, flagging refused conditional writes
+func putObjectError(err error, o *options) error {
+	if o.conditionalWrite && IsPreconditionFailed(err) {
+		return stageError(StagePut, fmt.Errorf("failed to put object: %w: %w", ErrConcurrentModification, err))
+	}
+	return stageError(StagePut, fmt.Errorf("failed to put object: %w", err))
+}
+
+// restoreWriteGrants re-applies the full ACL with PutObjectAcl when it contains WRITE
+// grants, which PutObject cannot set
+func restoreWriteGrants(ctx context.Context, client S3Client, bucket, key string, grants []types.Grant, o *options, result *OverwriteResult) error {
+	if !hasWriteGrant(grants) {
+		return nil
+	}
+	aclInput := &s3.PutObjectAclInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	addGrantsToInput(aclInput, grants, true)
+
+	putACLStart := time.Now()
+	err := retryStage(ctx, o, StagePutACL, func(int) error {
+		_, err := client.PutObjectAcl(ctx, aclInput)
+		return err
+	})
+	result.Timings.PutACL = time.Since(putACLStart)
 	if err != nil {
-		return fmt.Errorf("failed to open overwriting file: %w", err)
+		return stageError(StagePutACL, fmt.Errorf("failed to put object ACL: %w", err))
 	}
-	defer uploadFile.Close()
+	result.ACLRestored = true
+	return nil
+}
 
-	// Build PutObject input with simple ACL
-	putInput := &s3.PutObjectInput{
-		Bucket:                  aws.String(bucket),
-		Key:                     aws.String(key),
-		Body:                    uploadFile,
-		ACL:                     types.ObjectCannedACL(acl),
-		ContentType:             getResp.ContentType,
-		CacheControl:            getResp.CacheControl,
-		ContentDisposition:      getResp.ContentDisposition,
-		ContentEncoding:         getResp.ContentEncoding,
-		ContentLanguage:         getResp.ContentLanguage,
-		WebsiteRedirectLocation: getResp.WebsiteRedirectLocation,
-		StorageClass:            getResp.StorageClass,
-		Metadata:                convertMetadataFromPointers(info.Metadata), // Use metadata from callback-modified info
-		Tagging:                 tagging,
-	}
-
-	// Put object
-	if _, err := client.PutObject(ctx, putInput); err != nil {
-		return fmt.Errorf("failed to put object: %w", err)
+// uploadObject uploads file with PutObject, or with a multipart upload when it is larger
+// than the multipart threshold and the client supports it
+func uploadObject(ctx context.Context, client S3Client, putInput *s3.PutObjectInput, file *os.File, o *options, result *OverwriteResult) error {
+	stat, err := file.Stat()
+	if err != nil {
+		return err
 	}
+	size := stat.Size()
 
+	if size > o.multipartThreshold {
+		if mc, ok := client.(MultipartClient); ok {
+			completeResp, err := uploadMultipart(ctx, mc, putInput, fileParts(mc, putInput, file, size, o))
+			if err != nil {
+				return err
+			}
+			result.NewETag = completeResp.ETag
+			result.NewVersionId = completeResp.VersionId
+			result.BytesUploaded = size
+			return nil
+		}
+		if size > maxPutObjectSize {
+			return fmt.Errorf("%d bytes exceeds the PutObject limit and the client does not support multipart upload", size)
+		}
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	if err := addChecksumToPut(putInput, file); err != nil {
+		return err
+	}
+	putInput.Body = file
+	putInput.ContentLength = aws.Int64(size)
+	putResp, err := client.PutObject(ctx, putInput)
+	if err != nil {
+		return err
+	}
+	result.NewETag = putResp.ETag
+	result.NewVersionId = putResp.VersionId
+	result.BytesUploaded = size
 	return nil
 }
 
+// retryOnConcurrentModification runs attempt with a fresh result and restarts it
+// while it fails with ErrConcurrentModification and retries remain. A successful
+// write is recorded in the journal, and a dry run in the planner.
+func retryOnConcurrentModification(bucket, key string, o *options, attempt func(result *OverwriteResult) error) (*OverwriteResult, error) {
+	var result *OverwriteResult
+	var err error
+	for i := 0; i <= o.concurrencyRetries; i++ {
+		result = &OverwriteResult{Bucket: bucket, Key: key, Attempts: i + 1}
+		err = attempt(result)
+		if !errors.Is(err, ErrConcurrentModification) {
+			break
+		}
+	}
+	if err == nil && o.dryRun {
+		err = recordPlan(result, o)
+	} else if err == nil {
+		err = recordJournal(result, o)
+	}
+	return result, overwriteError(err, result)
+}
+
 // buildTaggingString converts S3 tags to query string format
 func buildTaggingString(tags []types.Tag) string {
 	if len(tags) == 0 {
@@ -401,6 +766,26 @@ func hasWriteGrant(grants []types.Grant) bool {
 	return false
 }
 
+// copyString returns a pointer to a copy of *s, or nil
+func copyString(s *string) *string {
+	if s == nil {
+		return nil
+	}
+	return aws.String(*s)
+}
+
+// parseExpires parses the raw Expires header, returning nil if it is absent or invalid
+func parseExpires(expires *string) *time.Time {
+	if expires == nil {
+		return nil
+	}
+	t, err := http.ParseTime(*expires)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
 // convertMetadataToPointers converts map[string]string to map[string]*string
 func convertMetadataToPointers(metadata map[string]string) map[string]*string {
 	if metadata == nil {
@@ -426,4 +811,4 @@ func convertMetadataFromPointers(metadata map[string]*string) map[string]string
 		}
 	}
 	return result
-}
\ No newline at end of file
+}
@@ -1,29 +1,60 @@
 package overwrite
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"fmt"
 	"io"
+	"maps"
+	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/aws/smithy-go"
 )
 
-// mockS3Client is a mock implementation of S3Client for testing
+// mockS3Client is a mock implementation of S3Client for testing. It also implements
+// MultipartClient, HeadClient, CopyClient, MultipartCopyClient and BatchClient; wrap it
+// in a struct embedding a narrower interface to test clients without them.
 type mockS3Client struct {
 	getObjectFunc        func(context.Context, *s3.GetObjectInput) (*s3.GetObjectOutput, error)
 	getObjectTaggingFunc func(context.Context, *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error)
 	getObjectAclFunc     func(context.Context, *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error)
 	putObjectFunc        func(context.Context, *s3.PutObjectInput) (*s3.PutObjectOutput, error)
 	putObjectAclFunc     func(context.Context, *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error)
+	headObjectFunc       func(context.Context, *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	uploadPartFunc       func(input *s3.UploadPartInput, data []byte, attempt int) error
+
+	getObjectErrors map[string]error // returned by GetObject for these keys
+	keys            []string         // listed by ListObjectsV2
+	pageSize        int              // keys per listing page (default 10)
+
+	// Recorded calls
+	mu            sync.Mutex
+	putInputs     []*s3.PutObjectInput
+	aclInputs     []*s3.PutObjectAclInput
+	copyInput     *s3.CopyObjectInput // the last one
+	copyInputs    []*s3.CopyObjectInput
+	listed        []*s3.ListObjectsV2Input
+	createInput   *s3.CreateMultipartUploadInput
+	completeInput *s3.CompleteMultipartUploadInput
+	parts         map[int32][]byte
+	partAttempts  map[int32]int
+	partRanges    map[int32]string
+	aborted       bool
 }
 
 func (m *mockS3Client) GetObject(ctx context.Context, input *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	if err := m.getObjectErrors[aws.ToString(input.Key)]; err != nil {
+		return nil, err
+	}
 	if m.getObjectFunc != nil {
 		return m.getObjectFunc(ctx, input)
 	}
@@ -45,6 +76,9 @@ func (m *mockS3Client) GetObjectAcl(ctx context.Context, input *s3.GetObjectAclI
 }
 
 func (m *mockS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	m.mu.Lock()
+	m.putInputs = append(m.putInputs, input)
+	m.mu.Unlock()
 	if m.putObjectFunc != nil {
 		return m.putObjectFunc(ctx, input)
 	}
@@ -52,12 +86,226 @@ func (m *mockS3Client) PutObject(ctx context.Context, input *s3.PutObjectInput,
 }
 
 func (m *mockS3Client) PutObjectAcl(ctx context.Context, input *s3.PutObjectAclInput, optFns ...func(*s3.Options)) (*s3.PutObjectAclOutput, error) {
+	m.mu.Lock()
+	m.aclInputs = append(m.aclInputs, input)
+	m.mu.Unlock()
 	if m.putObjectAclFunc != nil {
 		return m.putObjectAclFunc(ctx, input)
 	}
 	return nil, errors.New("not implemented")
 }
 
+func (m *mockS3Client) HeadObject(ctx context.Context, input *s3.HeadObjectInput, optFns ...func(*s3.Options)) (*s3.HeadObjectOutput, error) {
+	if m.headObjectFunc != nil {
+		return m.headObjectFunc(ctx, input)
+	}
+	return nil, errors.New("not implemented")
+}
+
+func (m *mockS3Client) CopyObject(ctx context.Context, input *s3.CopyObjectInput, optFns ...func(*s3.Options)) (*s3.CopyObjectOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.copyInput = input
+	m.copyInputs = append(m.copyInputs, input)
+	return &s3.CopyObjectOutput{
+		CopyObjectResult: &types.CopyObjectResult{ETag: aws.String(`"copy-etag"`)},
+		VersionId:        aws.String("v2"),
+	}, nil
+}
+
+func (m *mockS3Client) ListObjectsV2(ctx context.Context, input *s3.ListObjectsV2Input, optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	m.mu.Lock()
+	m.listed = append(m.listed, input)
+	m.mu.Unlock()
+
+	pageSize := m.pageSize
+	if pageSize == 0 {
+		pageSize = 10
+	}
+	start := 0
+	if input.ContinuationToken != nil {
+		fmt.Sscan(*input.ContinuationToken, &start)
+	}
+	end := min(start+pageSize, len(m.keys))
+	out := &s3.ListObjectsV2Output{}
+	for _, key := range m.keys[start:end] {
+		out.Contents = append(out.Contents, types.Object{Key: aws.String(key)})
+	}
+	if end < len(m.keys) {
+		out.IsTruncated = aws.Bool(true)
+		out.NextContinuationToken = aws.String(fmt.Sprint(end))
+	}
+	return out, nil
+}
+
+func (m *mockS3Client) CreateMultipartUpload(ctx context.Context, input *s3.CreateMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CreateMultipartUploadOutput, error) {
+	m.createInput = input
+	return &s3.CreateMultipartUploadOutput{UploadId: aws.String("upload-1")}, nil
+}
+
+func (m *mockS3Client) UploadPart(ctx context.Context, input *s3.UploadPartInput, optFns ...func(*s3.Options)) (*s3.UploadPartOutput, error) {
+	data, err := io.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	partNumber := aws.ToInt32(input.PartNumber)
+
+	m.mu.Lock()
+	if m.partAttempts == nil {
+		m.partAttempts = map[int32]int{}
+	}
+	m.partAttempts[partNumber]++
+	attempt := m.partAttempts[partNumber]
+	m.mu.Unlock()
+
+	if m.uploadPartFunc != nil {
+		if err := m.uploadPartFunc(input, data, attempt); err != nil {
+			return nil, err
+		}
+	}
+
+	m.mu.Lock()
+	if m.parts == nil {
+		m.parts = map[int32][]byte{}
+	}
+	m.parts[partNumber] = data
+	m.mu.Unlock()
+	return &s3.UploadPartOutput{ETag: aws.String("part-etag")}, nil
+}
+
+func (m *mockS3Client) UploadPartCopy(ctx context.Context, input *s3.UploadPartCopyInput, optFns ...func(*s3.Options)) (*s3.UploadPartCopyOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.partRanges == nil {
+		m.partRanges = map[int32]string{}
+	}
+	m.partRanges[aws.ToInt32(input.PartNumber)] = aws.ToString(input.CopySourceRange)
+	return &s3.UploadPartCopyOutput{CopyPartResult: &types.CopyPartResult{ETag: aws.String("part-etag")}}, nil
+}
+
+func (m *mockS3Client) CompleteMultipartUpload(ctx context.Context, input *s3.CompleteMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.CompleteMultipartUploadOutput, error) {
+	m.completeInput = input
+	return &s3.CompleteMultipartUploadOutput{ETag: aws.String(`"multipart-etag"`), VersionId: aws.String("v2")}, nil
+}
+
+func (m *mockS3Client) AbortMultipartUpload(ctx context.Context, input *s3.AbortMultipartUploadInput, optFns ...func(*s3.Options)) (*s3.AbortMultipartUploadOutput, error) {
+	m.aborted = true
+	return &s3.AbortMultipartUploadOutput{}, nil
+}
+
+// assembled joins the uploaded parts in order
+func (m *mockS3Client) assembled() []byte {
+	var buf bytes.Buffer
+	for i := int32(1); i <= int32(len(m.parts)); i++ {
+		buf.Write(m.parts[i])
+	}
+	return buf.Bytes()
+}
+
+// mockObject is the object served by newMockClient
+type mockObject struct {
+	body        string
+	contentType string
+	etag        string
+	versionID   string
+	owner       string
+	metadata    map[string]string
+	tags        []types.Tag
+	grants      []types.Grant
+	lockMode    types.ObjectLockMode
+	retainUntil *time.Time
+	legalHold   types.ObjectLockLegalHoldStatus
+}
+
+// taggedObject returns an object with metadata, a tag and a READ grant
+func taggedObject() mockObject {
+	return mockObject{
+		body:        "original",
+		contentType: "text/plain",
+		etag:        `"old-etag"`,
+		metadata:    map[string]string{"key1": "value1"},
+		tags:        []types.Tag{{Key: aws.String("tag1"), Value: aws.String("value1")}},
+		grants: []types.Grant{
+			{
+				Grantee:    &types.Grantee{Type: types.TypeCanonicalUser, ID: aws.String("123456")},
+				Permission: types.PermissionRead,
+			},
+		},
+	}
+}
+
+// newMockClient returns a mock client that serves obj under every key and accepts
+// every write
+func newMockClient(obj mockObject) *mockS3Client {
+	var tagCount *int32
+	if len(obj.tags) > 0 {
+		tagCount = aws.Int32(int32(len(obj.tags)))
+	}
+	optional := func(s string) *string {
+		if s == "" {
+			return nil
+		}
+		return aws.String(s)
+	}
+	return &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:                      io.NopCloser(strings.NewReader(obj.body)),
+				ContentLength:             aws.Int64(int64(len(obj.body))),
+				ContentType:               optional(obj.contentType),
+				ETag:                      optional(obj.etag),
+				VersionId:                 optional(obj.versionID),
+				Metadata:                  maps.Clone(obj.metadata),
+				TagCount:                  tagCount,
+				ObjectLockMode:            obj.lockMode,
+				ObjectLockRetainUntilDate: obj.retainUntil,
+				ObjectLockLegalHoldStatus: obj.legalHold,
+			}, nil
+		},
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{TagSet: obj.tags}, nil
+		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			out := &s3.GetObjectAclOutput{Grants: obj.grants}
+			if obj.owner != "" {
+				out.Owner = &types.Owner{ID: aws.String(obj.owner)}
+			}
+			return out, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			return &s3.PutObjectOutput{ETag: aws.String(`"new-etag"`)}, nil
+		},
+		putObjectAclFunc: func(ctx context.Context, input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+			return &s3.PutObjectAclOutput{}, nil
+		},
+		headObjectFunc: func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+			versionID := optional(obj.versionID)
+			if input.VersionId != nil {
+				versionID = input.VersionId
+			}
+			return &s3.HeadObjectOutput{
+				ContentLength:             aws.Int64(int64(len(obj.body))),
+				ContentType:               optional(obj.contentType),
+				ETag:                      optional(obj.etag),
+				VersionId:                 versionID,
+				Metadata:                  maps.Clone(obj.metadata),
+				ObjectLockMode:            obj.lockMode,
+				ObjectLockRetainUntilDate: obj.retainUntil,
+				ObjectLockLegalHoldStatus: obj.legalHold,
+			}, nil
+		},
+	}
+}
+
+// numberedKeys returns n keys of the form prefix000.txt
+func numberedKeys(prefix string, n int) []string {
+	var keys []string
+	for i := 0; i < n; i++ {
+		keys = append(keys, fmt.Sprintf("%s%03d.txt", prefix, i))
+	}
+	return keys
+}
+
 // Test OverwriteS3Object with successful overwrite
 func TestOverwriteS3Object_Success(t *testing.T) {
 	content := "test content"
@@ -112,7 +360,7 @@ func TestOverwriteS3Object_Success(t *testing.T) {
 	}
 
 	callbackCalled := false
-	err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		callbackCalled = true
 
 		// Verify ObjectInfo
@@ -168,13 +416,16 @@ func TestOverwriteS3Object_Skip(t *testing.T) {
 				Body: io.NopCloser(strings.NewReader("test content")),
 			}, nil
 		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{}, nil
+		},
 		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 			putObjectCalled = true
 			return &s3.PutObjectOutput{}, nil
 		},
 	}
 
-	err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		// Return empty string to skip overwrite
 		return "", false, nil
 	})
@@ -225,7 +476,7 @@ func TestOverwriteS3Object_WithWritePermission(t *testing.T) {
 		},
 	}
 
-	err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		// Return the same file to overwrite
 		return srcFilePath, false, nil
 	})
@@ -262,6 +513,9 @@ func TestOverwriteS3Object_Errors(t *testing.T) {
 						Body: io.NopCloser(strings.NewReader("test")),
 					}, nil
 				}
+				m.getObjectAclFunc = func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+					return &s3.GetObjectAclOutput{}, nil
+				}
 			},
 			expectedError: "callback error: callback failed",
 		},
@@ -318,7 +572,7 @@ func TestOverwriteS3Object_Errors(t *testing.T) {
 			client := &mockS3Client{}
 			tt.setupMock(client)
 
-			err := OverwriteS3Object(context.Background(), client, "bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			_, err := OverwriteS3Object(context.Background(), client, "bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 				if tt.name == "Callback error" {
 					return "", false, errors.New("callback failed")
 				}
@@ -372,7 +626,7 @@ func TestOverwriteS3ObjectWithAcl_Success(t *testing.T) {
 				},
 			}
 
-			err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", acl, func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			_, err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", acl, func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 				// Create a new file with modified content
 				modifiedFile, err := os.CreateTemp("", "modified-*.tmp")
 				if err != nil {
@@ -411,7 +665,7 @@ func TestOverwriteS3ObjectWithAcl_Skip(t *testing.T) {
 		},
 	}
 
-	err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", "private", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", "private", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		// Return empty string to skip overwrite
 		return "", false, nil
 	})
@@ -443,7 +697,7 @@ func TestAutoRemove(t *testing.T) {
 	}
 
 	// Test with autoRemove = true
-	err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		// Create a new temporary file
 		tmpFile, err := os.CreateTemp("", "autoremove-test-*.tmp")
 		if err != nil {
@@ -451,13 +705,13 @@ func TestAutoRemove(t *testing.T) {
 		}
 		tmpFile.Close()
 		createdFilePath = tmpFile.Name()
-		
+
 		// Write some content
 		if err := os.WriteFile(createdFilePath, []byte("new content"), 0600); err != nil {
 			os.Remove(createdFilePath)
 			return "", false, err
 		}
-		
+
 		return createdFilePath, true, nil // autoRemove = true
 	})
 
@@ -472,7 +726,7 @@ func TestAutoRemove(t *testing.T) {
 	}
 
 	// Test with autoRemove = false
-	err = OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err = OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		// Create a new temporary file
 		tmpFile, err := os.CreateTemp("", "no-autoremove-test-*.tmp")
 		if err != nil {
@@ -480,13 +734,13 @@ func TestAutoRemove(t *testing.T) {
 		}
 		tmpFile.Close()
 		createdFilePath = tmpFile.Name()
-		
+
 		// Write some content
 		if err := os.WriteFile(createdFilePath, []byte("new content"), 0600); err != nil {
 			os.Remove(createdFilePath)
 			return "", false, err
 		}
-		
+
 		return createdFilePath, false, nil // autoRemove = false
 	})
 
@@ -524,10 +778,10 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 		// This test verifies the logic, not the actual file existence (since defer will clean it up)
 		autoRemoveCalled := false
 		originalPath := ""
-		
+
 		// Create a custom client that tracks if the file would be removed
 		testClient := &mockS3Client{
-			getObjectFunc: client.getObjectFunc,
+			getObjectFunc:    client.getObjectFunc,
 			getObjectAclFunc: client.getObjectAclFunc,
 			putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 				// At this point, check if the file still exists
@@ -539,8 +793,8 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 				return &s3.PutObjectOutput{}, nil
 			},
 		}
-		
-		err := OverwriteS3Object(context.Background(), testClient, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+
+		_, err := OverwriteS3Object(context.Background(), testClient, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 			originalPath = srcFilePath
 			// Return the same file path with autoRemove=true
 			return srcFilePath, true, nil
@@ -558,7 +812,7 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 
 	t.Run("autoRemove with empty path", func(t *testing.T) {
 		// Test that autoRemove=true with empty path doesn't cause issues
-		err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		_, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 			// Return empty path (skip) with autoRemove=true
 			return "", true, nil
 		})
@@ -571,7 +825,7 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 	t.Run("autoRemove in OverwriteS3ObjectWithAcl", func(t *testing.T) {
 		// Test autoRemove functionality in OverwriteS3ObjectWithAcl
 		var createdFilePath string
-		err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", "private", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		_, err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", "private", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 			// Create a new temporary file
 			tmpFile, err := os.CreateTemp("", "acl-autoremove-test-*.tmp")
 			if err != nil {
@@ -579,13 +833,13 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 			}
 			tmpFile.Close()
 			createdFilePath = tmpFile.Name()
-			
+
 			// Write some content
 			if err := os.WriteFile(createdFilePath, []byte("new content"), 0600); err != nil {
 				os.Remove(createdFilePath)
 				return "", false, err
 			}
-			
+
 			return createdFilePath, true, nil // autoRemove = true
 		})
 
@@ -604,9 +858,9 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 		// Test that file is removed AFTER successful upload, not before
 		var fileExistsDuringUpload bool
 		createdFilePath := ""
-		
+
 		testClient := &mockS3Client{
-			getObjectFunc: client.getObjectFunc,
+			getObjectFunc:    client.getObjectFunc,
 			getObjectAclFunc: client.getObjectAclFunc,
 			putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
 				// Check if the file exists during upload
@@ -618,8 +872,8 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 				return &s3.PutObjectOutput{}, nil
 			},
 		}
-		
-		err := OverwriteS3Object(context.Background(), testClient, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+
+		_, err := OverwriteS3Object(context.Background(), testClient, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 			// Create a new temporary file
 			tmpFile, err := os.CreateTemp("", "upload-timing-test-*.tmp")
 			if err != nil {
@@ -627,13 +881,13 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 			}
 			tmpFile.Close()
 			createdFilePath = tmpFile.Name()
-			
+
 			// Write some content
 			if err := os.WriteFile(createdFilePath, []byte("test content"), 0600); err != nil {
 				os.Remove(createdFilePath)
 				return "", false, err
 			}
-			
+
 			return createdFilePath, true, nil // autoRemove = true
 		})
 
@@ -644,7 +898,7 @@ func TestAutoRemoveEdgeCases(t *testing.T) {
 		if !fileExistsDuringUpload {
 			t.Error("File was removed before upload completed")
 		}
-		
+
 		// File should be removed after upload
 		if _, err := os.Stat(createdFilePath); !os.IsNotExist(err) {
 			t.Error("File was not removed after upload")
@@ -672,7 +926,7 @@ func TestTemporaryFileCleanup(t *testing.T) {
 	}
 
 	// Test successful case - temp file should be cleaned up
-	err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		tmpFileName = srcFilePath
 		return srcFilePath, false, nil
 	})
@@ -687,7 +941,7 @@ func TestTemporaryFileCleanup(t *testing.T) {
 	}
 
 	// Test error case - temp file should still be cleaned up
-	err = OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	_, err = OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
 		tmpFileName = srcFilePath
 		return "", false, errors.New("intentional error")
 	})
@@ -702,7 +956,6 @@ func TestTemporaryFileCleanup(t *testing.T) {
 	}
 }
 
-
 // Test buildTaggingString
 func TestBuildTaggingString(t *testing.T) {
 	tests := []struct {
@@ -785,4 +1038,288 @@ func TestBuildGrantString(t *testing.T) {
 			}
 		})
 	}
-}
\ No newline at end of file
+}
+
+// Test conditional write sets IfMatch and reports concurrent modification
+func TestOverwriteS3Object_ConditionalWrite(t *testing.T) {
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body: io.NopCloser(strings.NewReader("test content")),
+				ETag: aws.String(`"etag-1"`),
+			}, nil
+		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			if aws.ToString(input.IfMatch) != `"etag-1"` {
+				t.Errorf("Expected IfMatch '\"etag-1\"', got %v", input.IfMatch)
+			}
+			return nil, &smithy.GenericAPIError{Code: "PreconditionFailed", Message: "At least one of the pre-conditions you specified did not hold"}
+		},
+	}
+
+	_, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithConditionalWrite())
+
+	if !errors.Is(err, ErrConcurrentModification) {
+		t.Fatalf("Expected ErrConcurrentModification, got %v", err)
+	}
+}
+
+// Test conditional write is not used unless requested
+func TestOverwriteS3Object_UnconditionalByDefault(t *testing.T) {
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body: io.NopCloser(strings.NewReader("test content")),
+				ETag: aws.String(`"etag-1"`),
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			if input.IfMatch != nil {
+				t.Errorf("Expected no IfMatch, got %v", *input.IfMatch)
+			}
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	_, err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", "private", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+// Test the overwrite is restarted from the download after a concurrent modification
+func TestOverwriteS3Object_ConcurrencyRetries(t *testing.T) {
+	etags := []string{`"etag-1"`, `"etag-2"`}
+	getCalls := 0
+	putCalls := 0
+	callbackCalls := 0
+
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			getCalls++
+			return &s3.GetObjectOutput{
+				Body: io.NopCloser(strings.NewReader("test content")),
+				ETag: aws.String(etags[getCalls-1]),
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putCalls++
+			if putCalls == 1 {
+				return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+			}
+			if aws.ToString(input.IfMatch) != `"etag-2"` {
+				t.Errorf("Expected IfMatch from second download, got %v", input.IfMatch)
+			}
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	result, err := OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", "private", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		callbackCalls++
+		return srcFilePath, false, nil
+	}, WithConcurrencyRetries(2))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", result.Attempts)
+	}
+	if getCalls != 2 || callbackCalls != 2 || putCalls != 2 {
+		t.Errorf("Expected 2 downloads, callbacks and uploads, got %d, %d, %d", getCalls, callbackCalls, putCalls)
+	}
+}
+
+// Test OverwriteResult reports what was written
+func TestOverwriteS3Object_Result(t *testing.T) {
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:      io.NopCloser(strings.NewReader("test content")),
+				ETag:      aws.String(`"old-etag"`),
+				VersionId: aws.String("v1"),
+				TagCount:  aws.Int32(1),
+			}, nil
+		},
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []types.Tag{{Key: aws.String("tag1"), Value: aws.String("value1")}},
+			}, nil
+		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{
+				Grants: []types.Grant{
+					{
+						Grantee:    &types.Grantee{Type: types.TypeCanonicalUser, ID: aws.String("123456")},
+						Permission: types.PermissionWrite,
+					},
+				},
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			return &s3.PutObjectOutput{ETag: aws.String(`"new-etag"`), VersionId: aws.String("v2")}, nil
+		},
+		putObjectAclFunc: func(ctx context.Context, input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+			return &s3.PutObjectAclOutput{}, nil
+		},
+	}
+
+	result, err := OverwriteS3Object(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		modifiedFile, err := os.CreateTemp("", "modified-*.tmp")
+		if err != nil {
+			return "", false, err
+		}
+		defer modifiedFile.Close()
+
+		if _, err := modifiedFile.WriteString("modified"); err != nil {
+			os.Remove(modifiedFile.Name())
+			return "", false, err
+		}
+		return modifiedFile.Name(), true, nil
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusWritten {
+		t.Errorf("Expected status %q, got %q", StatusWritten, result.Status)
+	}
+	if aws.ToString(result.OldETag) != `"old-etag"` || aws.ToString(result.OldVersionId) != "v1" {
+		t.Errorf("Unexpected old ETag/VersionId: %v/%v", aws.ToString(result.OldETag), aws.ToString(result.OldVersionId))
+	}
+	if aws.ToString(result.NewETag) != `"new-etag"` || aws.ToString(result.NewVersionId) != "v2" {
+		t.Errorf("Unexpected new ETag/VersionId: %v/%v", aws.ToString(result.NewETag), aws.ToString(result.NewVersionId))
+	}
+	if result.BytesDownloaded != int64(len("test content")) || result.BytesUploaded != int64(len("modified")) {
+		t.Errorf("Unexpected byte counts: %d/%d", result.BytesDownloaded, result.BytesUploaded)
+	}
+	if !result.ACLRestored {
+		t.Error("Expected ACLRestored to be true")
+	}
+	if len(result.Grants) != 1 || len(result.Tags) != 1 {
+		t.Errorf("Expected applied grants and tags, got %v and %v", result.Grants, result.Tags)
+	}
+	if result.Attempts != 1 {
+		t.Errorf("Expected 1 attempt, got %d", result.Attempts)
+	}
+
+	// Skipped overwrite
+	result, err = OverwriteS3ObjectWithAcl(context.Background(), client, "test-bucket", "test-key", "private", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return "", false, nil
+	})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusSkipped || result.NewETag != nil {
+		t.Errorf("Expected skipped result, got %+v", result)
+	}
+}
+
+// Test Overwrite with functional options
+func TestOverwrite_Options(t *testing.T) {
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body: io.NopCloser(strings.NewReader("test content")),
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			if input.ACL != types.ObjectCannedACLPublicRead {
+				t.Errorf("Expected ACL 'public-read', got %v", input.ACL)
+			}
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	tempDir := t.TempDir()
+	result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		if !strings.HasPrefix(srcFilePath, tempDir) {
+			t.Errorf("Expected temp file in %s, got %s", tempDir, srcFilePath)
+		}
+		return srcFilePath, false, nil
+	}, WithTempDir(tempDir), WithCannedACL("public-read"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.CannedACL != "public-read" {
+		t.Errorf("Expected canned ACL in result, got %q", result.CannedACL)
+	}
+
+	// WithPreservedACL undoes WithCannedACL, so GetObjectAcl is required again
+	_, err = Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}, WithCannedACL("public-read"), WithPreservedACL())
+
+	if err == nil || err.Error() != "failed to get object ACL: not implemented" {
+		t.Errorf("Expected GetObjectAcl to be called, got %v", err)
+	}
+}
+
+// Test the callback sees every preserved header and its changes are applied
+func TestOverwrite_Headers(t *testing.T) {
+	expires := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	var putInput *s3.PutObjectInput
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:                    io.NopCloser(strings.NewReader("test content")),
+				ContentType:             aws.String("application/octet-stream"),
+				CacheControl:            aws.String("no-cache"),
+				ContentDisposition:      aws.String("attachment"),
+				ContentEncoding:         aws.String("identity"),
+				ContentLanguage:         aws.String("en"),
+				ExpiresString:           aws.String(expires.Format(http.TimeFormat)),
+				WebsiteRedirectLocation: aws.String("/other"),
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putInput = input
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		h := info.Headers
+		if aws.ToString(h.ContentDisposition) != "attachment" || aws.ToString(h.ContentEncoding) != "identity" ||
+			aws.ToString(h.ContentLanguage) != "en" || aws.ToString(h.WebsiteRedirectLocation) != "/other" {
+			t.Errorf("Headers not exposed: %+v", h)
+		}
+		if h.Expires == nil || !h.Expires.Equal(expires) {
+			t.Errorf("Expected Expires %v, got %v", expires, h.Expires)
+		}
+		if info.Metadata == nil {
+			t.Error("Metadata should not be nil")
+		}
+
+		h.ContentType = aws.String("text/plain")
+		h.CacheControl = aws.String("max-age=60")
+		h.ContentEncoding = nil
+		info.Metadata["fixed"] = aws.String("true")
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if aws.ToString(putInput.ContentType) != "text/plain" || aws.ToString(putInput.CacheControl) != "max-age=60" {
+		t.Errorf("Header changes not applied: %v, %v", putInput.ContentType, putInput.CacheControl)
+	}
+	if putInput.ContentEncoding != nil {
+		t.Errorf("Expected ContentEncoding to be removed, got %v", aws.ToString(putInput.ContentEncoding))
+	}
+	if aws.ToString(putInput.ContentDisposition) != "attachment" || putInput.Expires == nil || !putInput.Expires.Equal(expires) {
+		t.Error("Unchanged headers not preserved")
+	}
+	if putInput.Metadata["fixed"] != "true" {
+		t.Errorf("Metadata change not applied, got %v", putInput.Metadata)
+	}
+}
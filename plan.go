@@ -0,0 +1,205 @@
+package overwrite
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// PlanEntry describes what an overwrite run with WithDryRun would do to an object
+type PlanEntry struct {
+	Bucket  string `json:"bucket"`
+	Key     string `json:"key"`
+	Skipped bool   `json:"skipped"`
+
+	OldSize   int64  `json:"old_size"`
+	NewSize   int64  `json:"new_size"`
+	OldSHA256 string `json:"old_sha256,omitempty"` // empty when the body is not read
+	NewSHA256 string `json:"new_sha256,omitempty"`
+
+	Metadata []Change `json:"metadata,omitempty"`
+	Headers  []Change `json:"headers,omitempty"`
+	Tags     []Change `json:"tags,omitempty"`
+
+	// CannedACL or Grants is the ACL that would be applied
+	CannedACL string  `json:"canned_acl,omitempty"`
+	Grants    []Grant `json:"grants,omitempty"`
+}
+
+// Change is a metadata key, header or tag whose value would change.
+// Old is nil for added values and New is nil for removed ones.
+type Change struct {
+	Name string  `json:"name"`
+	Old  *string `json:"old"`
+	New  *string `json:"new"`
+}
+
+// Planner receives the plan entry of every object processed with WithDryRun.
+// Plan may be called from several goroutines at once.
+type Planner interface {
+	Plan(entry PlanEntry) error
+}
+
+// PlannerFunc adapts a function to the Planner interface
+type PlannerFunc func(entry PlanEntry) error
+
+// Plan calls f(entry)
+func (f PlannerFunc) Plan(entry PlanEntry) error {
+	return f(entry)
+}
+
+// PlanWriter writes plan entries to an io.Writer as JSON lines
+type PlanWriter struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// NewPlanWriter returns a PlanWriter writing to w
+func NewPlanWriter(w io.Writer) *PlanWriter {
+	return &PlanWriter{enc: json.NewEncoder(w)}
+}
+
+// Plan writes entry as a single line
+func (p *PlanWriter) Plan(entry PlanEntry) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.enc.Encode(entry)
+}
+
+// recordPlan completes the plan of a dry run and hands it to the configured planner
+func recordPlan(result *OverwriteResult, o *options) error {
+	if result.Plan == nil {
+		result.Plan = &PlanEntry{Bucket: result.Bucket, Key: result.Key, Skipped: true}
+	}
+	if o.planner == nil {
+		return nil
+	}
+	if err := o.planner.Plan(*result.Plan); err != nil {
+		return stageError(StageRecord, fmt.Errorf("failed to record plan entry: %w", err))
+	}
+	return nil
+}
+
+// newPlanEntry compares the original object with the PutObject input that would
+// replace it
+func newPlanEntry(bucket, key string, getResp *s3.GetObjectOutput, oldTags []types.Tag, putInput *s3.PutObjectInput, acl *ObjectACL) *PlanEntry {
+	plan := &PlanEntry{
+		Bucket:    bucket,
+		Key:       key,
+		Metadata:  diffValues(getResp.Metadata, putInput.Metadata),
+		Headers:   diffValues(headerValues(newObjectHeaders(getResp)), headerValues(headersFromPut(putInput))),
+		Tags:      diffValues(tagsToMap(oldTags), tagsFromTagging(putInput.Tagging)),
+		CannedACL: string(putInput.ACL),
+	}
+	if plan.CannedACL == "" && acl != nil {
+		plan.Grants = acl.Grants
+	}
+	return plan
+}
+
+// planFiles completes plan with the size and digest of the downloaded body, taken
+// before the callback ran, and of the callback's output
+func planFiles(plan *PlanEntry, oldSize int64, oldSum, newPath string) error {
+	plan.OldSize, plan.OldSHA256 = oldSize, oldSum
+	var err error
+	if plan.NewSize, plan.NewSHA256, err = hashFile(newPath); err != nil {
+		return fmt.Errorf("failed to hash overwriting file: %w", err)
+	}
+	return nil
+}
+
+// headerValues maps the headers that are set to their values
+func headerValues(h *ObjectHeaders) map[string]string {
+	values := map[string]string{}
+	set := func(name string, v *string) {
+		if v != nil {
+			values[name] = *v
+		}
+	}
+	set("Content-Type", h.ContentType)
+	set("Cache-Control", h.CacheControl)
+	set("Content-Disposition", h.ContentDisposition)
+	set("Content-Encoding", h.ContentEncoding)
+	set("Content-Language", h.ContentLanguage)
+	if h.Expires != nil {
+		values["Expires"] = h.Expires.UTC().Format(http.TimeFormat)
+	}
+	set("x-amz-website-redirect-location", h.WebsiteRedirectLocation)
+	return values
+}
+
+// headersFromPut returns the headers set in PutObject input
+func headersFromPut(putInput *s3.PutObjectInput) *ObjectHeaders {
+	return &ObjectHeaders{
+		ContentType:             putInput.ContentType,
+		CacheControl:            putInput.CacheControl,
+		ContentDisposition:      putInput.ContentDisposition,
+		ContentEncoding:         putInput.ContentEncoding,
+		ContentLanguage:         putInput.ContentLanguage,
+		Expires:                 putInput.Expires,
+		WebsiteRedirectLocation: putInput.WebsiteRedirectLocation,
+	}
+}
+
+// tagsFromTagging parses the Tagging query string built by buildTaggingString
+func tagsFromTagging(tagging *string) map[string]string {
+	values, _ := url.ParseQuery(aws.ToString(tagging))
+	m := make(map[string]string, len(values))
+	for k, v := range values {
+		m[k] = v[0]
+	}
+	return m
+}
+
+// diffValues lists the names whose values differ between old and new, sorted by name
+func diffValues(old, new map[string]string) []Change {
+	var changes []Change
+	for name, v := range old {
+		if nv, ok := new[name]; !ok {
+			changes = append(changes, Change{Name: name, Old: aws.String(v)})
+		} else if nv != v {
+			changes = append(changes, Change{Name: name, Old: aws.String(v), New: aws.String(nv)})
+		}
+	}
+	for name, nv := range new {
+		if _, ok := old[name]; !ok {
+			changes = append(changes, Change{Name: name, New: aws.String(nv)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// hashFile returns the size and hex-encoded SHA-256 of the file at path
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hexSum(h), nil
+}
+
+// hexSum returns the hex-encoded sum of h
+func hexSum(h hash.Hash) string {
+	return hex.EncodeToString(h.Sum(nil))
+}
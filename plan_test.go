@@ -0,0 +1,139 @@
+package overwrite
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+const (
+	sha256Original = "0682c5f2076f099c34cfdd15a9e063849ed437a49677e6fcc5b4198c76575be5" // "original"
+	sha256Changed  = "bbbd110dbbc6761e506917b036ca9279e7dff49f0d378979dbd68dda531a8568" // "changed!!"
+)
+
+// Test a dry run runs the callback, writes nothing and describes the change
+func TestOverwrite_DryRun(t *testing.T) {
+	client := newMockClient(taggedObject())
+	client.putObjectAclFunc = func(ctx context.Context, input *s3.PutObjectAclInput) (*s3.PutObjectAclOutput, error) {
+		t.Error("PutObjectAcl must not be called")
+		return nil, nil
+	}
+	newFile := filepath.Join(t.TempDir(), "new.txt")
+	if err := os.WriteFile(newFile, []byte("changed!!"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	result, err := Overwrite(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		info.Metadata["key2"] = aws.String("value2")
+		delete(info.Metadata, "key1")
+		info.Headers.CacheControl = aws.String("no-cache")
+		info.Tags["tag1"] = "value2"
+		return newFile, false, nil
+	}, WithDryRun(NewPlanWriter(&out)), WithBackup(BackupLocation{Prefix: "backup/"}))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.putInputs) != 0 || len(client.copyInputs) != 0 {
+		t.Fatal("A dry run must not write anything")
+	}
+	if result.Status != StatusPlanned || result.Plan == nil {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+
+	var plan PlanEntry
+	if err := json.Unmarshal(out.Bytes(), &plan); err != nil {
+		t.Fatalf("Invalid plan JSON %q: %v", out.String(), err)
+	}
+	if plan.Bucket != "test-bucket" || plan.Key != "key" || plan.Skipped {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+	if plan.OldSize != 8 || plan.NewSize != 9 || plan.OldSHA256 != sha256Original || plan.NewSHA256 != sha256Changed {
+		t.Errorf("Unexpected sizes or digests %+v", plan)
+	}
+	if len(plan.Metadata) != 2 ||
+		plan.Metadata[0].Name != "key1" || aws.ToString(plan.Metadata[0].Old) != "value1" || plan.Metadata[0].New != nil ||
+		plan.Metadata[1].Name != "key2" || plan.Metadata[1].Old != nil || aws.ToString(plan.Metadata[1].New) != "value2" {
+		t.Errorf("Unexpected metadata changes %+v", plan.Metadata)
+	}
+	if len(plan.Headers) != 1 || plan.Headers[0].Name != "Cache-Control" || aws.ToString(plan.Headers[0].New) != "no-cache" {
+		t.Errorf("Unexpected header changes %+v", plan.Headers)
+	}
+	if len(plan.Tags) != 1 || aws.ToString(plan.Tags[0].Old) != "value1" || aws.ToString(plan.Tags[0].New) != "value2" {
+		t.Errorf("Unexpected tag changes %+v", plan.Tags)
+	}
+	if len(plan.Grants) != 1 || plan.Grants[0].ID != "123456" || plan.Grants[0].Permission != types.PermissionRead {
+		t.Errorf("Unexpected grants %+v", plan.Grants)
+	}
+
+	t.Run("edited in place", func(t *testing.T) {
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			return srcFilePath, false, os.WriteFile(srcFilePath, []byte("changed!!"), 0o600)
+		}, WithDryRun(nil))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		plan := result.Plan
+		if plan.OldSize != 8 || plan.OldSHA256 != sha256Original || plan.NewSize != 9 || plan.NewSHA256 != sha256Changed {
+			t.Errorf("Expected the original's size and digest before the edit, got %+v", plan)
+		}
+	})
+
+	t.Run("skipped", func(t *testing.T) {
+		out.Reset()
+		result, err := Overwrite(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			return "", false, nil
+		}, WithDryRun(NewPlanWriter(&out)))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Status != StatusSkipped || result.Plan == nil || !result.Plan.Skipped {
+			t.Errorf("Unexpected result %+v", result)
+		}
+		if !strings.Contains(out.String(), `"skipped":true`) {
+			t.Errorf("Expected a skipped plan entry, got %s", out.String())
+		}
+	})
+}
+
+// Test a streaming dry run digests both bodies without uploading
+func TestOverwriteStream_DryRun(t *testing.T) {
+	client := newMockClient(taggedObject())
+
+	result, err := OverwriteStream(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+		// Read only part of the original
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return err
+		}
+		_, err := w.Write(bytes.ToUpper(buf))
+		return err
+	}, WithDryRun(nil))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.putInputs) != 0 {
+		t.Fatal("A dry run must not write anything")
+	}
+	plan := result.Plan
+	if result.Status != StatusPlanned || plan == nil {
+		t.Fatalf("Unexpected result %+v", result)
+	}
+	if plan.OldSize != 8 || plan.OldSHA256 != sha256Original || plan.NewSize != 4 {
+		t.Errorf("Unexpected plan %+v", plan)
+	}
+	if len(plan.Metadata) != 0 || len(plan.Headers) != 0 || len(plan.Tags) != 0 {
+		t.Errorf("Expected no attribute changes, got %+v", plan)
+	}
+}
@@ -0,0 +1,74 @@
+package overwrite
+
+import (
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// OverwriteStatus describes what an overwrite did to the object
+type OverwriteStatus string
+
+const (
+	// StatusSkipped means the callback declined to overwrite the object
+	StatusSkipped OverwriteStatus = "skipped"
+	// StatusWritten means a new object was uploaded
+	StatusWritten OverwriteStatus = "written"
+	// StatusUnchanged means the callback changed neither the content nor the attributes,
+	// so nothing was uploaded (see WithSkipUnchanged)
+	StatusUnchanged OverwriteStatus = "unchanged"
+	// StatusPlanned means the object would have been written, but WithDryRun was given
+	StatusPlanned OverwriteStatus = "planned"
+)
+
+// StageTimings records how long each stage of an overwrite took
+type StageTimings struct {
+	Download   time.Duration // GetObject and copying the body to the temp file
+	Callback   time.Duration // the user callback
+	Attributes time.Duration // GetObjectTagging and GetObjectAcl
+	Backup     time.Duration // copying the original object (see WithBackup)
+	Upload     time.Duration // PutObject
+	PutACL     time.Duration // PutObjectAcl restoring WRITE grants
+	Verify     time.Duration // re-reading the written object (see WithVerify)
+}
+
+// OverwriteResult describes the outcome of an overwrite.
+// It is returned along with any error and reflects the stages that completed.
+type OverwriteResult struct {
+	Bucket string
+	Key    string
+	Status OverwriteStatus
+
+	OldETag      *string
+	OldVersionId *string
+	NewETag      *string
+	NewVersionId *string
+
+	BytesDownloaded int64
+	BytesUploaded   int64
+
+	// CannedACL is the simple ACL applied by OverwriteS3ObjectWithAcl
+	CannedACL string
+	// Grants are the preserved ACL grants applied by OverwriteS3Object
+	Grants []types.Grant
+	// ACLRestored reports whether PutObjectAcl ran to restore WRITE grants
+	ACLRestored bool
+	// ACLCompensation reports what was done after restoring WRITE grants failed
+	// (see WithACLFailurePolicy)
+	ACLCompensation ACLCompensation
+	// Tags are the tags applied to the new object
+	Tags []types.Tag
+
+	// BackupBucket, BackupKey and BackupVersionId locate the copy of the original
+	// object made by WithBackup
+	BackupBucket    string
+	BackupKey       string
+	BackupVersionId *string
+
+	// Plan describes what would change; it is only set with WithDryRun
+	Plan *PlanEntry
+
+	// Attempts is the number of times the overwrite was started (see WithConcurrencyRetries)
+	Attempts int
+	Timings  StageTimings
+}
@@ -0,0 +1,125 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"syscall"
+	"time"
+)
+
+// defaultMaxRetryDelay caps the backoff when RetryPolicy.MaxDelay is zero
+const defaultMaxRetryDelay = 20 * time.Second
+
+// retriedStages are the stages that make S3 calls and can be retried
+var retriedStages = []Stage{StageDownload, StageGetTagging, StageGetACL, StagePut, StagePutACL}
+
+// RetryPolicy controls how the S3 calls of a stage are retried (see WithRetryPolicy).
+// The delay before retry n is BaseDelay doubled n-1 times, capped at MaxDelay, of which
+// a random half is added as jitter.
+type RetryPolicy struct {
+	MaxAttempts int                  // attempts including the first; 1 or less means no retries
+	BaseDelay   time.Duration        // delay before the first retry
+	MaxDelay    time.Duration        // longest delay (default 20s)
+	Retryable   func(err error) bool // which errors are retried; nil means IsRetryable
+}
+
+// DefaultRetryPolicy returns a policy of 4 attempts with delays starting at 200ms
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 4, BaseDelay: 200 * time.Millisecond, MaxDelay: defaultMaxRetryDelay}
+}
+
+// retryable reports whether err should be retried under the policy
+func (p RetryPolicy) retryable(err error) bool {
+	if p.Retryable != nil {
+		return p.Retryable(err)
+	}
+	return IsRetryable(err)
+}
+
+// delay returns the jittered delay before retry n (counting from 1)
+func (p RetryPolicy) delay(n int) time.Duration {
+	if p.BaseDelay <= 0 {
+		return 0
+	}
+	maxDelay := p.MaxDelay
+	if maxDelay <= 0 {
+		maxDelay = defaultMaxRetryDelay
+	}
+	d := p.BaseDelay
+	for i := 1; i < n && d < maxDelay; i++ {
+		d *= 2
+	}
+	d = min(d, maxDelay)
+	return d/2 + rand.N(d/2+1)
+}
+
+// IsRetryable reports whether err is a transient failure worth retrying: S3 throttling
+// (SlowDown), an internal or unavailable service (5xx), a request timeout, a dropped or
+// timed-out connection, or a corrupted download. Cancelled contexts are never retryable.
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	switch errorCode(err) {
+	case "SlowDown", "InternalError", "ServiceUnavailable", "RequestTimeout", "RequestTimeoutException",
+		"Throttling", "ThrottlingException", "RequestLimitExceeded", "TooManyRequestsException", "OperationAborted":
+		return true
+	}
+	switch httpStatusCode(err) {
+	case 429, 500, 502, 503, 504:
+		return true
+	}
+	if errors.Is(err, ErrIntegrityCheckFailed) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// retryPolicy returns the policy configured for stage, or no retries
+func (o *options) retryPolicy(stage Stage) RetryPolicy {
+	if p, ok := o.retries[stage]; ok {
+		return p
+	}
+	return RetryPolicy{MaxAttempts: 1}
+}
+
+// retryStage runs call under the retry policy of stage, passing the attempt number
+// (counting from 1), until it succeeds, fails with an error the policy does not retry,
+// runs out of attempts or ctx is done. The last error is returned.
+func retryStage(ctx context.Context, o *options, stage Stage, call func(attempt int) error) error {
+	return retryWith(ctx, o.retryPolicy(stage), call)
+}
+
+// partRetryPolicy returns the policy a single part is retried under: WithPartRetries
+// sets the attempts, and the delays and retryable errors are those of the StagePut
+// policy, or of DefaultRetryPolicy when StagePut has none
+func (o *options) partRetryPolicy() RetryPolicy {
+	p, ok := o.retries[StagePut]
+	if !ok {
+		p = DefaultRetryPolicy()
+	}
+	p.MaxAttempts = o.partRetries + 1
+	return p
+}
+
+// retryWith runs call under policy p, as described for retryStage
+func retryWith(ctx context.Context, p RetryPolicy, call func(attempt int) error) error {
+	for attempt := 1; ; attempt++ {
+		err := call(attempt)
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.retryable(err) {
+			return err
+		}
+		timer := time.NewTimer(p.delay(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,245 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
+)
+
+// Test transient errors are told apart from permanent ones
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&smithy.GenericAPIError{Code: "SlowDown"}, true},
+		{&smithy.GenericAPIError{Code: "InternalError"}, true},
+		{fmt.Errorf("failed to put object: %w", &smithy.GenericAPIError{Code: "ServiceUnavailable"}), true},
+		{io.ErrUnexpectedEOF, true},
+		{&smithy.GenericAPIError{Code: "NoSuchKey"}, false},
+		{&smithy.GenericAPIError{Code: "AccessDenied"}, false},
+		{&smithy.GenericAPIError{Code: "PreconditionFailed"}, false},
+		{context.Canceled, false},
+		{errors.New("disk full"), false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsRetryable(tt.err); got != tt.want {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+// Test the backoff doubles up to the maximum delay, with jitter
+func TestRetryPolicy_Delay(t *testing.T) {
+	p := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	tests := []struct {
+		retry    int
+		min, max time.Duration
+	}{
+		{1, 50 * time.Millisecond, 100 * time.Millisecond},
+		{3, 200 * time.Millisecond, 400 * time.Millisecond},
+		{10, 500 * time.Millisecond, time.Second},
+	}
+	for _, tt := range tests {
+		for i := 0; i < 20; i++ {
+			if d := p.delay(tt.retry); d < tt.min || d > tt.max {
+				t.Errorf("delay(%d) = %v, want between %v and %v", tt.retry, d, tt.min, tt.max)
+			}
+		}
+	}
+	if d := (RetryPolicy{}).delay(1); d != 0 {
+		t.Errorf("Expected no delay without BaseDelay, got %v", d)
+	}
+}
+
+// failingReader returns its data, then err
+type failingReader struct {
+	r   io.Reader
+	err error
+}
+
+func (f *failingReader) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	if err == io.EOF {
+		return n, f.err
+	}
+	return n, err
+}
+
+// identityCallback uploads the downloaded file as it is
+func identityCallback(info ObjectInfo, srcFilePath string) (string, bool, error) {
+	return srcFilePath, false, nil
+}
+
+// retryObject is the object the retry tests overwrite
+var retryObject = mockObject{body: "hello world", etag: `"etag"`, versionID: "v1"}
+
+// Test failed S3 calls are retried under the stage's policy
+func TestOverwrite_RetryPolicy(t *testing.T) {
+	ctx := context.Background()
+	policy := RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond}
+	slowDown := &smithy.GenericAPIError{Code: "SlowDown"}
+
+	t.Run("upload reuses the callback output", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		var bodies []string
+		client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			body, _ := io.ReadAll(input.Body)
+			bodies = append(bodies, string(body))
+			if len(bodies) < 3 {
+				return nil, slowDown
+			}
+			return &s3.PutObjectOutput{}, nil
+		}
+		calls := 0
+		callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			calls++
+			outPath := srcFilePath + ".out"
+			return outPath, true, os.WriteFile(outPath, []byte("HELLO WORLD"), 0644)
+		}
+		result, err := Overwrite(ctx, client, "test-bucket", "key", callback, WithRetryPolicy(policy))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if calls != 1 || result.Status != StatusWritten {
+			t.Errorf("Expected one callback and a write, got %d and %s", calls, result.Status)
+		}
+		if len(bodies) != 3 || bodies[0] != "HELLO WORLD" || bodies[2] != "HELLO WORLD" {
+			t.Errorf("Expected the same body on every attempt, got %q", bodies)
+		}
+	})
+
+	t.Run("attempts run out", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		puts := 0
+		client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			puts++
+			return nil, slowDown
+		}
+		_, err := Overwrite(ctx, client, "test-bucket", "key", identityCallback, WithRetryPolicy(policy))
+		var oe *OverwriteError
+		if !errors.As(err, &oe) || oe.Stage != StagePut || puts != 3 {
+			t.Errorf("Expected a Put error after 3 attempts, got %d attempts: %v", puts, err)
+		}
+	})
+
+	t.Run("permanent errors are not retried", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		puts := 0
+		client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			puts++
+			return nil, &smithy.GenericAPIError{Code: "AccessDenied"}
+		}
+		if _, err := Overwrite(ctx, client, "test-bucket", "key", identityCallback, WithRetryPolicy(policy)); err == nil || puts != 1 {
+			t.Errorf("Expected a single attempt, got %d: %v", puts, err)
+		}
+	})
+
+	t.Run("other stages", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		puts, acls := 0, 0
+		client.getObjectAclFunc = func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			if acls++; acls == 1 {
+				return nil, slowDown
+			}
+			return &s3.GetObjectAclOutput{}, nil
+		}
+		client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			puts++
+			return nil, slowDown
+		}
+		_, err := Overwrite(ctx, client, "test-bucket", "key", identityCallback, WithRetryPolicy(policy, StageGetACL))
+		var oe *OverwriteError
+		if !errors.As(err, &oe) || oe.Stage != StagePut || acls != 2 || puts != 1 {
+			t.Errorf("Expected GetObjectAcl to be retried and PutObject not, got %d and %d: %v", acls, puts, err)
+		}
+	})
+
+	t.Run("head object", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		headObject, heads := client.headObjectFunc, 0
+		client.headObjectFunc = func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+			if heads++; heads == 1 {
+				return nil, slowDown
+			}
+			return headObject(ctx, input)
+		}
+		result, err := OverwriteMetadata(ctx, client, "test-bucket", "key", func(info ObjectInfo) (bool, error) {
+			info.Metadata["key2"] = aws.String("value2")
+			return true, nil
+		}, WithRetryPolicy(policy, StageDownload))
+		if err != nil || heads != 2 || result.Status != StatusWritten {
+			t.Errorf("Expected HeadObject to be retried, got %d attempts: %v", heads, err)
+		}
+	})
+
+	t.Run("verification", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		getObjectAcl, acls := client.getObjectAclFunc, 0
+		client.getObjectAclFunc = func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			// The second call is the verification's
+			if acls++; acls == 2 {
+				return nil, slowDown
+			}
+			return getObjectAcl(ctx, input)
+		}
+		_, err := Overwrite(ctx, client, "test-bucket", "key", identityCallback, WithVerify(), WithRetryPolicy(policy, StageGetACL))
+		if err != nil || acls != 3 {
+			t.Errorf("Expected the verification's GetObjectAcl to be retried, got %d calls: %v", acls, err)
+		}
+	})
+
+	t.Run("interrupted download", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		var gets []*s3.GetObjectInput
+		client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			gets = append(gets, input)
+			body := io.Reader(strings.NewReader("hello world"))
+			if len(gets) == 1 {
+				body = &failingReader{r: strings.NewReader("hello"), err: io.ErrUnexpectedEOF}
+			}
+			return &s3.GetObjectOutput{Body: io.NopCloser(body), ETag: aws.String(`"etag"`), VersionId: aws.String("v1")}, nil
+		}
+		var content []byte
+		callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			content, _ = os.ReadFile(srcFilePath)
+			return srcFilePath, false, nil
+		}
+		result, err := Overwrite(ctx, client, "test-bucket", "key", callback, WithRetryPolicy(policy, StageDownload))
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if string(content) != "hello world" || result.BytesDownloaded != 11 {
+			t.Errorf("Expected the full body, got %q (%d bytes)", content, result.BytesDownloaded)
+		}
+		if len(gets) != 2 || aws.ToString(gets[1].VersionId) != "v1" || aws.ToString(gets[1].IfMatch) != `"etag"` {
+			t.Errorf("Expected the same version to be fetched again, got %+v", gets)
+		}
+	})
+
+	t.Run("object replaced during the download", func(t *testing.T) {
+		client := newMockClient(retryObject)
+		gets := 0
+		client.getObjectFunc = func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			if gets++; gets > 1 {
+				return nil, &smithy.GenericAPIError{Code: "PreconditionFailed"}
+			}
+			body := &failingReader{r: strings.NewReader("hello"), err: io.ErrUnexpectedEOF}
+			return &s3.GetObjectOutput{Body: io.NopCloser(body), ETag: aws.String(`"etag"`)}, nil
+		}
+		_, err := Overwrite(ctx, client, "test-bucket", "key", identityCallback, WithRetryPolicy(policy))
+		if !errors.Is(err, ErrConcurrentModification) || gets != 2 {
+			t.Errorf("Expected ErrConcurrentModification after 2 GetObject calls, got %d: %v", gets, err)
+		}
+	})
+}
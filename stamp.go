@@ -0,0 +1,26 @@
+package overwrite
+
+// TransformStampKey is the metadata key (x-amz-meta-overwrite-transform) written by
+// WithTransformStamp
+const TransformStampKey = "overwrite-transform"
+
+// hasStamp reports whether the object already carries the configured transform stamp
+func hasStamp(info ObjectInfo, o *options) bool {
+	if o.stamp == "" {
+		return false
+	}
+	v := info.Metadata[TransformStampKey]
+	return v != nil && *v == o.stamp
+}
+
+// addStampToMetadata records the configured transform stamp in metadata
+func addStampToMetadata(metadata map[string]string, o *options) map[string]string {
+	if o.stamp == "" {
+		return metadata
+	}
+	if metadata == nil {
+		metadata = make(map[string]string)
+	}
+	metadata[TransformStampKey] = o.stamp
+	return metadata
+}
@@ -0,0 +1,105 @@
+package overwrite
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// Test the transform stamp is written and stamped objects are skipped at HEAD
+func TestOverwrite_TransformStamp(t *testing.T) {
+	stored := map[string]string{"key1": "value1"}
+	getObjectCalls := 0
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			getObjectCalls++
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("test content")), Metadata: stored}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			stored = input.Metadata
+			return &s3.PutObjectOutput{}, nil
+		},
+		headObjectFunc: func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{Metadata: stored}, nil
+		},
+	}
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", callback,
+		WithCannedACL("private"), WithTransformStamp("resize", "v1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusWritten || stored[TransformStampKey] != "resize@v1" || stored["key1"] != "value1" {
+		t.Errorf("Expected the stamp to be written, got %v", stored)
+	}
+
+	// Running again is a no-op that costs only a HEAD
+	result, err = Overwrite(context.Background(), client, "test-bucket", "test-key", callback,
+		WithCannedACL("private"), WithTransformStamp("resize", "v1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusSkipped || getObjectCalls != 1 {
+		t.Errorf("Expected the stamped object to be skipped without GetObject, got %s after %d GetObject calls", result.Status, getObjectCalls)
+	}
+
+	// A version bump applies the transform again
+	result, err = Overwrite(context.Background(), client, "test-bucket", "test-key", callback,
+		WithCannedACL("private"), WithTransformStamp("resize", "v2"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusWritten || stored[TransformStampKey] != "resize@v2" {
+		t.Errorf("Expected the new version to be applied, got %v", stored)
+	}
+}
+
+// Test the stamp check falls back to GetObject and applies to metadata-only overwrites
+func TestOverwrite_TransformStampFallback(t *testing.T) {
+	body := &countingReader{r: strings.NewReader("test content")}
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:     io.NopCloser(body),
+				Metadata: map[string]string{TransformStampKey: "resize@v1"},
+			}, nil
+		},
+	}
+
+	result, err := OverwriteStream(context.Background(), struct{ S3Client }{client}, "test-bucket", "test-key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+		t.Error("Callback should not be called")
+		return nil
+	}, WithTransformStamp("resize", "v1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusSkipped || body.n != 0 {
+		t.Error("Expected the stamped object to be skipped without reading the body")
+	}
+
+	copyClient := &mockS3Client{
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{}, nil
+		},
+		headObjectFunc: func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+			return &s3.HeadObjectOutput{}, nil
+		},
+	}
+	_, err = OverwriteMetadata(context.Background(), copyClient, "test-bucket", "test-key", func(info ObjectInfo) (bool, error) {
+		info.Headers.CacheControl = aws.String("no-cache")
+		return true, nil
+	}, WithCannedACL("private"), WithTransformStamp("cache", "v1"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if copyClient.copyInput.Metadata[TransformStampKey] != "cache@v1" {
+		t.Errorf("Expected the stamp on the copy, got %v", copyClient.copyInput.Metadata)
+	}
+}
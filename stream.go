@@ -0,0 +1,283 @@
+package overwrite
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrSkip can be returned by a StreamCallback, before it writes anything,
+// to leave the object unchanged
+var ErrSkip = errors.New("skip overwrite")
+
+// StreamCallback defines the streaming callback function signature
+// The callback reads the original object body from r and writes the new body to w.
+// Changes to info.Metadata, info.Headers, info.Tags and info.ACL must be made
+// before the first write to w.
+// Returning ErrSkip leaves the object unchanged; any other error aborts the overwrite.
+type StreamCallback func(info ObjectInfo, r io.Reader, w io.Writer) error
+
+// OverwriteStream overwrites an S3 object by piping its body through callback straight
+// into the upload, without a local temp file. Output that fits in one part is sent with
+// PutObject; larger output is sent as a multipart upload, which requires MultipartClient.
+// Metadata, headers, tags and the ACL are preserved exactly as in Overwrite.
+func OverwriteStream(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	callback StreamCallback,
+	opts ...Option,
+) (*OverwriteResult, error) {
+	o := newOptions(opts)
+	return retryOnConcurrentModification(bucket, key, o, func(result *OverwriteResult) error {
+		return overwriteStream(ctx, client, bucket, key, callback, o, result)
+	})
+}
+
+// overwriteStream performs a single streaming overwrite attempt
+func overwriteStream(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	callback StreamCallback,
+	o *options,
+	result *OverwriteResult,
+) error {
+	// Open object
+	downloadStart := time.Now()
+	if skip, err := decideBeforeGet(ctx, client, bucket, key, o, result); skip || err != nil {
+		return err
+	}
+	src, err := getSource(ctx, client, bucket, key, o, result)
+	if err != nil {
+		return err
+	}
+	getResp := src.getResp
+	defer func() {
+		_ = getResp.Body.Close()
+	}()
+	if skip, err := decideAfterGet(client, bucket, key, getResp, o, result); skip || err != nil {
+		return err
+	}
+	result.Timings.Download = time.Since(downloadStart)
+
+	// Check Object Lock before reading the body
+	if skip, err := checkObjectLock(src, o, result); skip || err != nil {
+		return err
+	}
+
+	// The upload needs the tags and ACL before the callback finishes
+	attributesStart := time.Now()
+	tags, err := getTags(ctx, client, bucket, key, getResp, o)
+	if err != nil {
+		return err
+	}
+	acl, err := getACL(ctx, client, bucket, key, nil, o)
+	if err != nil {
+		return err
+	}
+	src.acl = acl.clone()
+	result.Timings.Attributes = time.Since(attributesStart)
+
+	// Build ObjectInfo
+	info := newObjectInfo(bucket, key, getResp, tags, acl)
+
+	// Run the callback, piping its output to the upload
+	pr, pw := io.Pipe()
+	verified := newVerifiedBody(getResp)
+	body := &countingReader{r: verified}
+	oldHash := sha256.New()
+	if o.dryRun || o.skipUnchanged {
+		body.r = io.TeeReader(verified, oldHash)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pw.CloseWithError(callback(info, body, pw))
+	}()
+	// Never return while the callback runs: fail its pending writes and reads, then
+	// wait for it to give up
+	defer func() {
+		_ = pr.Close()
+		_ = getResp.Body.Close()
+		<-done
+	}()
+
+	// Read the first part to choose between PutObject and multipart upload
+	callbackStart := time.Now()
+	partSize := max(o.partSize, minPartSize)
+	first, err := readPart(pr, partSize)
+	single := errors.Is(err, io.EOF)
+	if err != nil && !single {
+		return streamCallbackError(err, result)
+	}
+
+	if single {
+		result.Timings.Callback = time.Since(callbackStart)
+	}
+
+	return writeObject(ctx, client, bucket, key, src, info, tags, callbackOutput{
+		unchanged: func() (bool, error) {
+			// Output larger than a part is never held whole, so it counts as a change
+			if !single {
+				return false, nil
+			}
+			if err := drainOriginal(body, result); err != nil {
+				return false, err
+			}
+			newSum := sha256.Sum256(first)
+			return body.n == int64(len(first)) && hexSum(oldHash) == hex.EncodeToString(newSum[:]), nil
+		},
+		plan: func(plan *PlanEntry) (bool, error) {
+			newHash := sha256.New()
+			rest, err := io.Copy(newHash, io.MultiReader(bytes.NewReader(first), pr))
+			result.Timings.Callback = time.Since(callbackStart)
+			if err != nil {
+				return true, streamCallbackError(err, result)
+			}
+			if err := drainOriginal(body, result); err != nil {
+				return false, err
+			}
+			plan.OldSize, plan.OldSHA256 = body.n, hexSum(oldHash)
+			plan.NewSize, plan.NewSHA256 = rest, hexSum(newHash)
+			return false, nil
+		},
+		write: func(putInput *s3.PutObjectInput) (bool, error) {
+			if single {
+				// The whole output fits in one part
+				reader := bytes.NewReader(first)
+				if err := addChecksumToPut(putInput, reader); err != nil {
+					return false, stageError(StagePut, err)
+				}
+				putInput.Body = reader
+				putInput.ContentLength = aws.Int64(int64(len(first)))
+				putResp, err := client.PutObject(ctx, putInput)
+				if err != nil {
+					return false, putObjectError(err, o)
+				}
+				result.NewETag = putResp.ETag
+				result.NewVersionId = putResp.VersionId
+				result.BytesUploaded = int64(len(first))
+			} else {
+				mc, ok := client.(MultipartClient)
+				if !ok {
+					return false, stageError(StagePut, fmt.Errorf("failed to put object: streaming output exceeds %d bytes and the client does not support multipart upload", partSize))
+				}
+				var callbackErr error
+				completeResp, err := uploadMultipart(ctx, mc, putInput, streamParts(mc, putInput, first, pr, partSize, o, &callbackErr, &result.BytesUploaded))
+				result.Timings.Callback = time.Since(callbackStart)
+				if callbackErr != nil {
+					result.BytesUploaded = 0
+					return true, streamCallbackError(callbackErr, result)
+				}
+				if err != nil {
+					return false, putObjectError(err, o)
+				}
+				result.NewETag = completeResp.ETag
+				result.NewVersionId = completeResp.VersionId
+			}
+			result.BytesDownloaded = body.n
+			return false, nil
+		},
+	}, o, result)
+}
+
+// drainOriginal reads what the callback left of the original body, so that its size
+// and digest are complete
+func drainOriginal(body *countingReader, result *OverwriteResult) error {
+	_, err := io.Copy(io.Discard, body)
+	result.BytesDownloaded = body.n
+	if err != nil {
+		return stageError(StageDownload, fmt.Errorf("failed to read object content: %w", err))
+	}
+	return nil
+}
+
+// streamCallbackError turns an error from the callback side of the pipe into the
+// overwrite's outcome
+func streamCallbackError(err error, result *OverwriteResult) error {
+	if errors.Is(err, ErrSkip) {
+		result.Status = StatusSkipped
+		return nil
+	}
+	return stageError(StageCallback, fmt.Errorf("callback error: %w", err))
+}
+
+// streamParts returns a partUploader that uploads first and then the rest of r in
+// partSize chunks. A read error from r is stored in callbackErr.
+func streamParts(
+	client MultipartClient,
+	putInput *s3.PutObjectInput,
+	first []byte,
+	r io.Reader,
+	partSize int64,
+	o *options,
+	callbackErr *error,
+	uploaded *int64,
+) partUploader {
+	return func(ctx context.Context, uploadID *string) ([]types.CompletedPart, error) {
+		g := newPartGroup(ctx, o.multipartConcurrency)
+		buf := first
+		last := false
+		for partNumber := int32(1); ; partNumber++ {
+			if partNumber > maxParts {
+				_, _ = g.Wait()
+				return nil, fmt.Errorf("streaming output exceeds %d parts", maxParts)
+			}
+			pn := partNumber
+			section := io.NewSectionReader(bytes.NewReader(buf), 0, int64(len(buf)))
+			*uploaded += int64(len(buf))
+			started := g.Go(func(ctx context.Context) (types.CompletedPart, error) {
+				return uploadPart(ctx, client, putInput, uploadID, pn, section, o.partRetryPolicy())
+			})
+			if !started || last {
+				break
+			}
+
+			next, err := readPart(r, partSize)
+			if errors.Is(err, io.EOF) {
+				if len(next) == 0 {
+					break
+				}
+				last = true
+			} else if err != nil {
+				_, _ = g.Wait()
+				*callbackErr = err
+				return nil, err
+			}
+			buf = next
+		}
+		return g.Wait()
+	}
+}
+
+// readPart reads up to size bytes of r. The buffer grows as the output arrives, so
+// small output does not cost a whole part. io.EOF is returned if r ends first.
+func readPart(r io.Reader, size int64) ([]byte, error) {
+	var buf bytes.Buffer
+	_, err := io.CopyN(&buf, r, size)
+	return buf.Bytes(), err
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
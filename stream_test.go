@@ -0,0 +1,180 @@
+package overwrite
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test small streaming output is uploaded with PutObject and attributes are preserved
+func TestOverwriteStream_Small(t *testing.T) {
+	var uploaded []byte
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:        io.NopCloser(strings.NewReader("test content")),
+				ContentType: aws.String("text/plain"),
+				Metadata:    map[string]string{"key1": "value1"},
+				TagCount:    aws.Int32(1),
+			}, nil
+		},
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []types.Tag{{Key: aws.String("tag1"), Value: aws.String("value1")}},
+			}, nil
+		},
+		getObjectAclFunc: func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			return &s3.GetObjectAclOutput{
+				Grants: []types.Grant{
+					{
+						Grantee:    &types.Grantee{Type: types.TypeCanonicalUser, ID: aws.String("123456")},
+						Permission: types.PermissionRead,
+					},
+				},
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			data, err := io.ReadAll(input.Body)
+			if err != nil {
+				return nil, err
+			}
+			uploaded = data
+			if aws.ToString(input.ContentType) != "text/plain" {
+				t.Errorf("Content type not preserved, got %v", input.ContentType)
+			}
+			if aws.ToString(input.Tagging) != "tag1=value1" {
+				t.Errorf("Tags not preserved, got %v", input.Tagging)
+			}
+			if aws.ToString(input.GrantRead) != `id="123456"` {
+				t.Errorf("Grants not preserved, got %v", input.GrantRead)
+			}
+			if input.Metadata["key1"] != "value1" || input.Metadata["streamed"] != "true" {
+				t.Errorf("Metadata not preserved, got %v", input.Metadata)
+			}
+			return &s3.PutObjectOutput{ETag: aws.String(`"new-etag"`)}, nil
+		},
+	}
+
+	result, err := OverwriteStream(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+		info.Metadata["streamed"] = aws.String("true")
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(bytes.ToUpper(data))
+		return err
+	})
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(uploaded) != "TEST CONTENT" {
+		t.Errorf("Expected 'TEST CONTENT', got '%s'", uploaded)
+	}
+	if result.Status != StatusWritten || aws.ToString(result.NewETag) != `"new-etag"` {
+		t.Errorf("Unexpected result %+v", result)
+	}
+	if result.BytesDownloaded != 12 || result.BytesUploaded != 12 {
+		t.Errorf("Unexpected byte counts %d/%d", result.BytesDownloaded, result.BytesUploaded)
+	}
+}
+
+// Test large streaming output is uploaded in parts
+func TestOverwriteStream_Multipart(t *testing.T) {
+	source := bytes.Repeat([]byte("abcdefghij"), 1100*1024) // 11 MiB
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(source))}, nil
+		},
+	}
+
+	result, err := OverwriteStream(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+		_, err := io.Copy(w, r)
+		return err
+	}, WithCannedACL("private"), WithPartSize(5*1024*1024))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(client.parts) != 3 {
+		t.Errorf("Expected 3 parts, got %d", len(client.parts))
+	}
+	if !bytes.Equal(client.assembled(), source) {
+		t.Error("Uploaded parts do not match the streamed content")
+	}
+	if client.createInput.ACL != types.ObjectCannedACLPrivate {
+		t.Errorf("Expected private ACL, got %q", client.createInput.ACL)
+	}
+	if result.BytesUploaded != int64(len(source)) || result.BytesDownloaded != int64(len(source)) {
+		t.Errorf("Unexpected byte counts %d/%d", result.BytesDownloaded, result.BytesUploaded)
+	}
+}
+
+// Test ErrSkip and callback errors leave the object unchanged
+func TestOverwriteStream_SkipAndError(t *testing.T) {
+	putObjectCalled := false
+	base := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{Body: io.NopCloser(strings.NewReader("test content"))}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putObjectCalled = true
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	t.Run("skip", func(t *testing.T) {
+		result, err := OverwriteStream(context.Background(), base, "test-bucket", "test-key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+			return ErrSkip
+		}, WithCannedACL("private"))
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Status != StatusSkipped || putObjectCalled {
+			t.Error("Expected the object to be skipped without PutObject")
+		}
+	})
+
+	t.Run("error after multipart started", func(t *testing.T) {
+		client := base
+		_, err := OverwriteStream(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+			if _, err := w.Write(make([]byte, 6*1024*1024)); err != nil {
+				return err
+			}
+			return errors.New("transform failed")
+		}, WithCannedACL("private"), WithPartSize(5*1024*1024))
+
+		if err == nil || err.Error() != "callback error: transform failed" {
+			t.Fatalf("Expected callback error, got %v", err)
+		}
+		if !client.aborted || client.completeInput != nil {
+			t.Error("Expected the multipart upload to be aborted")
+		}
+	})
+
+	t.Run("large output without multipart support", func(t *testing.T) {
+		returned := false
+		client := struct{ S3Client }{base}
+		_, err := OverwriteStream(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+			defer func() { returned = true }()
+			_, err := w.Write(make([]byte, 6*1024*1024))
+			return err
+		}, WithCannedACL("private"), WithPartSize(5*1024*1024))
+
+		if err == nil || !strings.Contains(err.Error(), "does not support multipart upload") {
+			t.Fatalf("Expected multipart support error, got %v", err)
+		}
+		// The blocked write is failed and the callback has returned
+		if !returned {
+			t.Error("Expected the callback to have returned")
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package overwrite
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3 object tagging limits
+const (
+	maxTags           = 10
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+)
+
+// ErrInvalidTags is returned (wrapped) when the tags set by the callback exceed S3's limits
+var ErrInvalidTags = errors.New("invalid tags")
+
+// tagsToMap converts an S3 tag set to the map exposed in ObjectInfo
+func tagsToMap(tags []types.Tag) map[string]string {
+	m := make(map[string]string, len(tags))
+	for _, tag := range tags {
+		m[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+	return m
+}
+
+// tagsFromMap validates the tags in m and converts them to an S3 tag set sorted by key
+func tagsFromMap(m map[string]string) ([]types.Tag, error) {
+	if len(m) > maxTags {
+		return nil, fmt.Errorf("%w: %d tags exceeds the limit of %d", ErrInvalidTags, len(m), maxTags)
+	}
+
+	keys := make([]string, 0, len(m))
+	for k, v := range m {
+		if k == "" {
+			return nil, fmt.Errorf("%w: empty key", ErrInvalidTags)
+		}
+		if utf8.RuneCountInString(k) > maxTagKeyLength {
+			return nil, fmt.Errorf("%w: key %q exceeds %d characters", ErrInvalidTags, k, maxTagKeyLength)
+		}
+		if utf8.RuneCountInString(v) > maxTagValueLength {
+			return nil, fmt.Errorf("%w: value of key %q exceeds %d characters", ErrInvalidTags, k, maxTagValueLength)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var tags []types.Tag
+	for _, k := range keys {
+		tags = append(tags, types.Tag{Key: aws.String(k), Value: aws.String(m[k])})
+	}
+	return tags, nil
+}
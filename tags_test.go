@@ -0,0 +1,106 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test the callback can add and remove tags
+func TestOverwrite_EditTags(t *testing.T) {
+	var putInput *s3.PutObjectInput
+	putObjectCalled := false
+	client := &mockS3Client{
+		getObjectFunc: func(ctx context.Context, input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+			return &s3.GetObjectOutput{
+				Body:     io.NopCloser(strings.NewReader("test content")),
+				TagCount: aws.Int32(2),
+			}, nil
+		},
+		getObjectTaggingFunc: func(ctx context.Context, input *s3.GetObjectTaggingInput) (*s3.GetObjectTaggingOutput, error) {
+			return &s3.GetObjectTaggingOutput{
+				TagSet: []types.Tag{
+					{Key: aws.String("stale"), Value: aws.String("yes")},
+					{Key: aws.String("owner"), Value: aws.String("team a")},
+				},
+			}, nil
+		},
+		putObjectFunc: func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+			putObjectCalled = true
+			putInput = input
+			return &s3.PutObjectOutput{}, nil
+		},
+	}
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		if info.Tags["owner"] != "team a" || info.Tags["stale"] != "yes" {
+			t.Errorf("Tags not loaded before the callback, got %v", info.Tags)
+		}
+		delete(info.Tags, "stale")
+		info.Tags["processed"] = "v3"
+		return srcFilePath, false, nil
+	}, WithCannedACL("private"))
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if aws.ToString(putInput.Tagging) != "owner=team+a&processed=v3" {
+		t.Errorf("Expected edited tags, got %v", aws.ToString(putInput.Tagging))
+	}
+	if len(result.Tags) != 2 {
+		t.Errorf("Expected 2 tags in result, got %v", result.Tags)
+	}
+
+	t.Run("invalid tags", func(t *testing.T) {
+		putObjectCalled = false
+		_, err := Overwrite(context.Background(), client, "test-bucket", "test-key", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			info.Tags[strings.Repeat("k", 129)] = "v"
+			return srcFilePath, false, nil
+		}, WithCannedACL("private"))
+
+		if !errors.Is(err, ErrInvalidTags) {
+			t.Fatalf("Expected ErrInvalidTags, got %v", err)
+		}
+		if putObjectCalled {
+			t.Error("PutObject should not be called with invalid tags")
+		}
+	})
+}
+
+// Test tag validation against S3's limits
+func TestTagsFromMap(t *testing.T) {
+	tooMany := map[string]string{}
+	for i := 0; i < 11; i++ {
+		tooMany[string(rune('a'+i))] = "v"
+	}
+
+	tests := []struct {
+		name    string
+		tags    map[string]string
+		wantErr bool
+	}{
+		{"empty", map[string]string{}, false},
+		{"nil", nil, false},
+		{"limits", map[string]string{strings.Repeat("k", 128): strings.Repeat("v", 256)}, false},
+		{"multibyte", map[string]string{strings.Repeat("キ", 128): strings.Repeat("値", 256)}, false},
+		{"too many", tooMany, true},
+		{"empty key", map[string]string{"": "v"}, true},
+		{"long key", map[string]string{strings.Repeat("k", 129): "v"}, true},
+		{"long value", map[string]string{"k": strings.Repeat("v", 257)}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tagsFromMap(tt.tags)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("tagsFromMap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+package overwrite
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// attributesUnchanged reports whether the callback left the metadata, headers, tags and
+// grants in info as they were read. A simple ACL (WithCannedACL) always counts as a
+// change, because the object's current ACL is not read in that mode.
+func attributesUnchanged(src *source, oldTags []types.Tag, info ObjectInfo, grants []types.Grant, o *options) bool {
+	if o.cannedACL != "" {
+		return false
+	}
+	oldGrants, err := src.acl.s3Grants()
+	if err != nil {
+		return false
+	}
+	getResp := src.getResp
+	return len(diffValues(getResp.Metadata, convertMetadataFromPointers(info.Metadata))) == 0 &&
+		len(diffValues(headerValues(newObjectHeaders(getResp)), headerValues(infoHeaders(info)))) == 0 &&
+		len(diffValues(tagsToMap(oldTags), info.Tags)) == 0 &&
+		len(diffValues(grantSet(oldGrants), grantSet(grants))) == 0
+}
+
+// contentUnchanged reports whether the file at path has the size and SHA-256 of the
+// original body
+func contentUnchanged(path string, oldSize int64, oldSum string) (bool, error) {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to stat overwriting file: %w", err)
+	}
+	if stat.Size() != oldSize {
+		return false, nil
+	}
+	_, sum, err := hashFile(path)
+	if err != nil {
+		return false, fmt.Errorf("failed to hash overwriting file: %w", err)
+	}
+	return sum == oldSum, nil
+}
+
+// infoHeaders returns the headers in info, which the callback may have set to nil
+func infoHeaders(info ObjectInfo) *ObjectHeaders {
+	if info.Headers == nil {
+		return &ObjectHeaders{}
+	}
+	return info.Headers
+}
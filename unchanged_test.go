@@ -0,0 +1,117 @@
+package overwrite
+
+import (
+	"context"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test the upload is skipped when the callback changes nothing
+func TestOverwrite_SkipUnchanged(t *testing.T) {
+	writeFile := func(content string) OverwriteCallback {
+		return func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			outPath := srcFilePath + ".out"
+			return outPath, true, os.WriteFile(outPath, []byte(content), 0644)
+		}
+	}
+	tests := []struct {
+		name     string
+		callback OverwriteCallback
+		opts     []Option
+		want     OverwriteStatus
+	}{
+		{"same file", identityCallback, []Option{WithSkipUnchanged()}, StatusUnchanged},
+		{"identical output", writeFile("original"), []Option{WithSkipUnchanged()}, StatusUnchanged},
+		{"new content", writeFile("changed!"), []Option{WithSkipUnchanged()}, StatusWritten},
+		{"without the option", identityCallback, nil, StatusWritten},
+		{"simple ACL", identityCallback, []Option{WithSkipUnchanged(), WithCannedACL("private")}, StatusWritten},
+		{"metadata", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			info.Metadata["key2"] = aws.String("value2")
+			return srcFilePath, false, nil
+		}, []Option{WithSkipUnchanged()}, StatusWritten},
+		{"header", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			info.Headers.CacheControl = aws.String("no-cache")
+			return srcFilePath, false, nil
+		}, []Option{WithSkipUnchanged()}, StatusWritten},
+		{"tag", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			delete(info.Tags, "tag1")
+			return srcFilePath, false, nil
+		}, []Option{WithSkipUnchanged()}, StatusWritten},
+		{"grant", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			info.ACL.Grants = append(info.ACL.Grants, Grant{URI: AllUsersURI, Permission: types.PermissionRead})
+			return srcFilePath, false, nil
+		}, []Option{WithSkipUnchanged()}, StatusWritten},
+		{"email grant", func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+			info.ACL.Grants = append(info.ACL.Grants, Grant{EmailAddress: "user@example.com", Permission: types.PermissionRead})
+			return srcFilePath, false, nil
+		}, []Option{WithSkipUnchanged()}, StatusWritten},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newMockClient(taggedObject())
+			result, err := Overwrite(context.Background(), client, "test-bucket", "key", tt.callback, tt.opts...)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Status != tt.want {
+				t.Errorf("Expected %s, got %s", tt.want, result.Status)
+			}
+			if written := len(client.putInputs) > 0; written != (tt.want == StatusWritten) {
+				t.Errorf("Unexpected PutObject calls: %d", len(client.putInputs))
+			}
+		})
+	}
+}
+
+// Test OverwriteMetadata skips the copy when the callback changes nothing
+func TestOverwriteMetadata_SkipUnchanged(t *testing.T) {
+	client := newMockClient(taggedObject())
+	client.headObjectFunc = func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+		return &s3.HeadObjectOutput{ContentLength: aws.Int64(8), Metadata: map[string]string{"key1": "value1"}}, nil
+	}
+	result, err := OverwriteMetadata(context.Background(), client, "test-bucket", "key", func(info ObjectInfo) (bool, error) {
+		return true, nil
+	}, WithSkipUnchanged())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if result.Status != StatusUnchanged || len(client.copyInputs) != 0 {
+		t.Errorf("Expected no copy, got %s and %d copies", result.Status, len(client.copyInputs))
+	}
+}
+
+// Test OverwriteStream skips the upload when the output fits in one part and is unchanged
+func TestOverwriteStream_SkipUnchanged(t *testing.T) {
+	tests := []struct {
+		name   string
+		output string
+		want   OverwriteStatus
+	}{
+		{"same body", "original", StatusUnchanged},
+		{"new body", "changed!", StatusWritten},
+		{"longer body", "original!", StatusWritten},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client := newMockClient(taggedObject())
+			result, err := OverwriteStream(context.Background(), client, "test-bucket", "key", func(info ObjectInfo, r io.Reader, w io.Writer) error {
+				_, err := io.WriteString(w, tt.output)
+				return err
+			}, WithSkipUnchanged())
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result.Status != tt.want || result.BytesDownloaded != 8 {
+				t.Errorf("Expected %s after reading 8 bytes, got %s after %d", tt.want, result.Status, result.BytesDownloaded)
+			}
+			if written := len(client.putInputs) > 0; written != (tt.want == StatusWritten) {
+				t.Errorf("Unexpected PutObject calls: %d", len(client.putInputs))
+			}
+		})
+	}
+}
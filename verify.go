@@ -0,0 +1,159 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ErrVerificationFailed is returned (wrapped in a *VerificationError) when the written
+// object does not carry the metadata, headers, tags or grants that were intended
+var ErrVerificationFailed = errors.New("verification failed")
+
+// Mismatch is an attribute of the written object that differs from what was intended.
+// Want is nil for unexpected values and Got is nil for missing ones.
+type Mismatch struct {
+	Kind string // "metadata", "header", "tag" or "grant"
+	Name string
+	Want *string
+	Got  *string
+}
+
+// VerificationError lists the mismatches found by WithVerify.
+// It wraps ErrVerificationFailed.
+type VerificationError struct {
+	Bucket     string
+	Key        string
+	Mismatches []Mismatch
+}
+
+func (e *VerificationError) Error() string {
+	var parts []string
+	for _, m := range e.Mismatches {
+		parts = append(parts, fmt.Sprintf("%s %s: want %s, got %s", m.Kind, m.Name, quoteOrNone(m.Want), quoteOrNone(m.Got)))
+	}
+	return fmt.Sprintf("%s: s3://%s/%s: %s", ErrVerificationFailed, e.Bucket, e.Key, strings.Join(parts, "; "))
+}
+
+func (e *VerificationError) Unwrap() error {
+	return ErrVerificationFailed
+}
+
+// quoteOrNone quotes *s, or returns "none" if s is nil
+func quoteOrNone(s *string) string {
+	if s == nil {
+		return "none"
+	}
+	return fmt.Sprintf("%q", *s)
+}
+
+// verifyWrite re-reads the written object's attributes and compares them with putInput
+// and grants. Headers that were not set are not compared, because S3 fills in defaults,
+// and grants are not compared when a simple ACL was applied.
+func verifyWrite(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	putInput *s3.PutObjectInput,
+	grants []types.Grant,
+	o *options,
+	result *OverwriteResult,
+) error {
+	if !o.verify {
+		return nil
+	}
+	return stageError(StageVerify, verify(ctx, client, bucket, key, putInput, grants, o, result))
+}
+
+// verify performs the checks of verifyWrite
+func verify(
+	ctx context.Context,
+	client S3Client,
+	bucket string,
+	key string,
+	putInput *s3.PutObjectInput,
+	grants []types.Grant,
+	o *options,
+	result *OverwriteResult,
+) error {
+	hc, ok := client.(HeadClient)
+	if !ok {
+		return errors.New("failed to verify object: the client does not implement HeadClient")
+	}
+
+	verifyStart := time.Now()
+	defer func() {
+		result.Timings.Verify = time.Since(verifyStart)
+	}()
+
+	written, err := headSource(ctx, hc, bucket, key, result.NewVersionId, o, &OverwriteResult{})
+	if err != nil {
+		return fmt.Errorf("failed to verify object: %w", err)
+	}
+	tags, err := fetchTags(ctx, client, bucket, key, result.NewVersionId, o)
+	if err != nil {
+		return fmt.Errorf("failed to verify object: %w", err)
+	}
+
+	verr := &VerificationError{Bucket: bucket, Key: key}
+	add := func(kind string, changes []Change) {
+		for _, c := range changes {
+			verr.Mismatches = append(verr.Mismatches, Mismatch{Kind: kind, Name: c.Name, Want: c.Old, Got: c.New})
+		}
+	}
+	add("metadata", diffValues(lowerKeys(putInput.Metadata), lowerKeys(written.getResp.Metadata)))
+	wantHeaders := headerValues(headersFromPut(putInput))
+	gotHeaders := headerValues(newObjectHeaders(written.getResp))
+	for name := range gotHeaders {
+		if _, ok := wantHeaders[name]; !ok {
+			delete(gotHeaders, name)
+		}
+	}
+	add("header", diffValues(wantHeaders, gotHeaders))
+	add("tag", diffValues(tagsFromTagging(putInput.Tagging), tagsToMap(tags)))
+
+	if putInput.ACL == "" {
+		var aclResp *s3.GetObjectAclOutput
+		err := retryStage(ctx, o, StageGetACL, func(int) error {
+			var err error
+			aclResp, err = client.GetObjectAcl(ctx, &s3.GetObjectAclInput{
+				Bucket:    aws.String(bucket),
+				Key:       aws.String(key),
+				VersionId: result.NewVersionId,
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("failed to verify object: failed to get object ACL: %w", err)
+		}
+		// S3 reports grants to email addresses by canonical ID, so they are not compared
+		want := grantSet(grants)
+		for k := range want {
+			if strings.HasPrefix(k, "email=") {
+				delete(want, k)
+			}
+		}
+		add("grant", diffValues(want, grantSet(aclResp.Grants)))
+	}
+
+	if len(verr.Mismatches) > 0 {
+		return verr
+	}
+	return nil
+}
+
+// lowerKeys returns m with lower-case keys, as S3 returns metadata keys
+func lowerKeys(m map[string]string) map[string]string {
+	lower := make(map[string]string, len(m))
+	for k, v := range m {
+		lower[strings.ToLower(k)] = v
+	}
+	return lower
+}
@@ -0,0 +1,76 @@
+package overwrite
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Test WithVerify re-reads the written version and reports what did not survive
+func TestOverwrite_Verify(t *testing.T) {
+	client := newMockClient(taggedObject())
+	client.putObjectFunc = func(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+		return &s3.PutObjectOutput{VersionId: aws.String("v2")}, nil
+	}
+	var headInput *s3.HeadObjectInput
+	written := &s3.HeadObjectOutput{
+		ContentType:  aws.String("text/plain"),
+		CacheControl: aws.String("max-age=60"), // not set by the overwrite, so not compared
+		Metadata:     map[string]string{"key1": "value1"},
+	}
+	client.headObjectFunc = func(ctx context.Context, input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+		headInput = input
+		return written, nil
+	}
+	callback := func(info ObjectInfo, srcFilePath string) (string, bool, error) {
+		return srcFilePath, false, nil
+	}
+
+	result, err := Overwrite(context.Background(), client, "test-bucket", "key", callback, WithVerify())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if aws.ToString(headInput.VersionId) != "v2" {
+		t.Errorf("Expected the written version to be verified, got %v", headInput.VersionId)
+	}
+	if result.Status != StatusWritten {
+		t.Errorf("Unexpected result %+v", result)
+	}
+
+	t.Run("mismatch", func(t *testing.T) {
+		written.Metadata = map[string]string{"key1": "other"}
+		client.getObjectAclFunc = func(ctx context.Context, input *s3.GetObjectAclInput) (*s3.GetObjectAclOutput, error) {
+			// The first call reads the original ACL; the second verifies the written one
+			if input.VersionId == nil {
+				return &s3.GetObjectAclOutput{Grants: []types.Grant{
+					{Grantee: &types.Grantee{ID: aws.String("123456")}, Permission: types.PermissionRead},
+				}}, nil
+			}
+			return &s3.GetObjectAclOutput{}, nil
+		}
+
+		_, err := Overwrite(context.Background(), client, "test-bucket", "key", callback, WithVerify())
+		if !errors.Is(err, ErrVerificationFailed) {
+			t.Fatalf("Expected a verification error, got %v", err)
+		}
+		var verr *VerificationError
+		if !errors.As(err, &verr) {
+			t.Fatalf("Expected a *VerificationError, got %T", err)
+		}
+		if len(verr.Mismatches) != 2 {
+			t.Fatalf("Expected 2 mismatches, got %+v", verr.Mismatches)
+		}
+		m := verr.Mismatches[0]
+		if m.Kind != "metadata" || m.Name != "key1" || aws.ToString(m.Want) != "value1" || aws.ToString(m.Got) != "other" {
+			t.Errorf("Unexpected metadata mismatch %+v", m)
+		}
+		m = verr.Mismatches[1]
+		if m.Kind != "grant" || m.Name != "id=123456 READ" || m.Got != nil {
+			t.Errorf("Unexpected grant mismatch %+v", m)
+		}
+	})
+}